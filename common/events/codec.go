@@ -0,0 +1,59 @@
+package events
+
+import (
+	"encoding/json"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+)
+
+// Codec serializes event payloads.
+type Codec interface {
+	ContentType() string
+	Marshal(event interface{}) ([]byte, error)
+	Unmarshal(data []byte, event interface{}) error
+}
+
+var JSON Codec = jsonCodec{}
+var Protobuf Codec = protobufCodec{}
+
+var codecs = map[string]Codec{
+	JSON.ContentType():     JSON,
+	Protobuf.ContentType(): Protobuf,
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Marshal(event interface{}) ([]byte, error) {
+	return json.Marshal(event)
+}
+
+func (jsonCodec) Unmarshal(data []byte, event interface{}) error {
+	return json.Unmarshal(data, event)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string {
+	return "application/protobuf"
+}
+
+func (protobufCodec) Marshal(event interface{}) ([]byte, error) {
+	msg, ok := event.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("%T is not a protobuf message", event)
+	}
+	return proto.Marshal(msg)
+}
+
+func (protobufCodec) Unmarshal(data []byte, event interface{}) error {
+	msg, ok := event.(proto.Message)
+	if !ok {
+		return errors.Errorf("%T is not a protobuf message", event)
+	}
+	return proto.Unmarshal(data, msg)
+}
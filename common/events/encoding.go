@@ -0,0 +1,50 @@
+package events
+
+import (
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+)
+
+// ContentEncodingKey is the attribute holding how the message payload is encoded for transport.
+const ContentEncodingKey = "content-encoding"
+
+const (
+	// ContentEncodingBase64 is the legacy encoding, readable by all subscribers.
+	ContentEncodingBase64 = "base64"
+	// ContentEncodingRaw sends the payload as is.
+	ContentEncodingRaw = "raw"
+)
+
+// EncodePayload encodes the payload for transport using the given content encoding.
+func EncodePayload(encoding string, payload []byte) ([]byte, error) {
+	switch encoding {
+	case ContentEncodingBase64:
+		return []byte(base64.StdEncoding.EncodeToString(payload)), nil
+	case ContentEncodingRaw:
+		return payload, nil
+	default:
+		return nil, errors.Errorf("unknown content encoding %v", encoding)
+	}
+}
+
+// DecodePayload decodes the payload according to the content encoding attribute, messages without it are legacy base64.
+func DecodePayload(data []byte, attributes map[string]string) ([]byte, error) {
+	encoding, ok := attributes[ContentEncodingKey]
+	if !ok {
+		encoding = ContentEncodingBase64
+	}
+
+	switch encoding {
+	case ContentEncodingBase64:
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't base64 decode payload")
+		}
+		return decoded, nil
+	case ContentEncodingRaw:
+		return data, nil
+	default:
+		return nil, errors.Errorf("unknown content encoding %v", encoding)
+	}
+}
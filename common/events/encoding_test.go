@@ -0,0 +1,53 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestPayloadEncoding(t *testing.T) {
+	payload := []byte(`{"user_id":"123"}`)
+
+	for _, encoding := range []string{ContentEncodingBase64, ContentEncodingRaw} {
+		data, err := EncodePayload(encoding, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodePayload(data, map[string]string{ContentEncodingKey: encoding})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded) != string(payload) {
+			t.Errorf("%v: expected %s, got %s", encoding, payload, decoded)
+		}
+	}
+
+	// Messages without the attribute are legacy base64.
+	legacy, _ := EncodePayload(ContentEncodingBase64, payload)
+	decoded, err := DecodePayload(legacy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != string(payload) {
+		t.Errorf("expected %s, got %s", payload, decoded)
+	}
+	if _, err := DecodePayload(payload, nil); err == nil {
+		t.Error("expected error for a raw payload without the attribute")
+	}
+
+	// A raw payload which happens to be valid base64 is taken as is when marked raw.
+	id := []byte("user1234")
+	decoded, err = DecodePayload(id, map[string]string{ContentEncodingKey: ContentEncodingRaw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != string(id) {
+		t.Errorf("expected %s, got %s", id, decoded)
+	}
+
+	if _, err := DecodePayload(payload, map[string]string{ContentEncodingKey: "gzip"}); err == nil {
+		t.Error("expected error for unknown content encoding")
+	}
+	if _, err := EncodePayload("gzip", payload); err == nil {
+		t.Error("expected error for unknown content encoding")
+	}
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Attributes describing the schema of a typed event.
+const (
+	EventNameKey     = "event_name"
+	SchemaVersionKey = "schema_version"
+	ContentTypeKey   = "content_type"
+)
+
+// Schema describes a typed event.
+type Schema struct {
+	Name string
+	// Version should be bumped on every change of the event structure, newer events are rejected.
+	Version int
+	// Codec is used to encode the event. Events are decoded using the codec they were encoded with.
+	Codec Codec
+	// New returns a pointer to a new, empty event.
+	New func() interface{}
+	// DecodeLegacy, if set, decodes events published without schema attributes, before typed events were introduced.
+	DecodeLegacy func(data []byte, attributes map[string]string) (interface{}, error)
+}
+
+// Registry maps event types to their schemas, so producers and consumers agree on them.
+type Registry struct {
+	mutex  sync.RWMutex
+	byName map[string]*Schema
+	byType map[reflect.Type]*Schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]*Schema),
+		byType: make(map[reflect.Type]*Schema),
+	}
+}
+
+// DefaultRegistry is used by the publisher and subscriber, packages owning an event register it in init.
+var DefaultRegistry = NewRegistry()
+
+// Register adds the schema to the default registry.
+func Register(schema *Schema) {
+	DefaultRegistry.Register(schema)
+}
+
+// Register adds the schema to the registry. It panics if the name or type is already registered.
+func (r *Registry) Register(schema *Schema) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	eventType := reflect.TypeOf(schema.New())
+	if _, ok := r.byName[schema.Name]; ok {
+		panic(fmt.Sprintf("event %v already registered", schema.Name))
+	}
+	if _, ok := r.byType[eventType]; ok {
+		panic(fmt.Sprintf("event type %v already registered", eventType))
+	}
+
+	r.byName[schema.Name] = schema
+	r.byType[eventType] = schema
+}
+
+// Encode encodes a pointer to a registered event type, returning the payload and its schema attributes.
+func (r *Registry) Encode(event interface{}) ([]byte, map[string]string, error) {
+	r.mutex.RLock()
+	schema, ok := r.byType[reflect.TypeOf(event)]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil, nil, errors.Errorf("event type %T not registered", event)
+	}
+
+	data, err := schema.Codec.Marshal(event)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "couldn't marshal %v event", schema.Name)
+	}
+
+	return data, map[string]string{
+		EventNameKey:     schema.Name,
+		SchemaVersionKey: strconv.Itoa(schema.Version),
+		ContentTypeKey:   schema.Codec.ContentType(),
+	}, nil
+}
+
+// Decode decodes the payload of an event of the given name into a pointer of the schema's type.
+func (r *Registry) Decode(name string, data []byte, attributes map[string]string) (interface{}, error) {
+	r.mutex.RLock()
+	schema, ok := r.byName[name]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("event %v not registered", name)
+	}
+
+	eventName, ok := attributes[EventNameKey]
+	if !ok {
+		if schema.DecodeLegacy == nil {
+			return nil, errors.Errorf("missing event name, expected %v event", name)
+		}
+		return schema.DecodeLegacy(data, attributes)
+	}
+	if eventName != name {
+		return nil, errors.Errorf("received %v event, expected %v", eventName, name)
+	}
+
+	version, err := strconv.Atoi(attributes[SchemaVersionKey])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid schema version")
+	}
+	if version > schema.Version {
+		return nil, errors.Errorf("%v event schema version %d is newer than the supported %d", name, version, schema.Version)
+	}
+
+	codec, ok := codecs[attributes[ContentTypeKey]]
+	if !ok {
+		return nil, errors.Errorf("unknown content type: %v", attributes[ContentTypeKey])
+	}
+
+	event := schema.New()
+	err = codec.Unmarshal(data, event)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't unmarshal %v event", name)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+type testEvent struct {
+	UserID string `json:"user_id"`
+}
+
+func newTestRegistry() *Registry {
+	registry := NewRegistry()
+	registry.Register(&Schema{
+		Name:    "test",
+		Version: 2,
+		Codec:   JSON,
+		New: func() interface{} {
+			return &testEvent{}
+		},
+		DecodeLegacy: func(data []byte, attributes map[string]string) (interface{}, error) {
+			return &testEvent{UserID: string(data)}, nil
+		},
+	})
+	registry.Register(&Schema{
+		Name:    "test_protobuf",
+		Version: 1,
+		Codec:   Protobuf,
+		New: func() interface{} {
+			return &wrappers.StringValue{}
+		},
+	})
+	return registry
+}
+
+func TestRegistry_RoundTrip(t *testing.T) {
+	registry := newTestRegistry()
+
+	data, attributes, err := registry.Encode(&testEvent{UserID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes[EventNameKey] != "test" || attributes[SchemaVersionKey] != "2" || attributes[ContentTypeKey] != JSON.ContentType() {
+		t.Errorf("unexpected attributes: %v", attributes)
+	}
+
+	event, err := registry.Decode("test", data, attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.(*testEvent).UserID != "1" {
+		t.Errorf("decoded %+v", event)
+	}
+
+	data, attributes, err = registry.Encode(&wrappers.StringValue{Value: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err = registry.Decode("test_protobuf", data, attributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.(*wrappers.StringValue).Value != "hello" {
+		t.Errorf("decoded %+v", event)
+	}
+}
+
+func TestRegistry_Decode(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		attributes map[string]string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "With a legacy event, I want it decoded by the legacy decoder",
+			data:       "1",
+			attributes: map[string]string{},
+			want:       "1",
+		},
+		{
+			name:       "With an older schema version, I want it decoded",
+			data:       `{"user_id":"1"}`,
+			attributes: map[string]string{EventNameKey: "test", SchemaVersionKey: "1", ContentTypeKey: JSON.ContentType()},
+			want:       "1",
+		},
+		{
+			name:       "With a newer schema version, I want an error",
+			data:       `{"user_id":"1"}`,
+			attributes: map[string]string{EventNameKey: "test", SchemaVersionKey: "3", ContentTypeKey: JSON.ContentType()},
+			wantErr:    true,
+		},
+		{
+			name:       "With a different event, I want an error",
+			data:       `{"user_id":"1"}`,
+			attributes: map[string]string{EventNameKey: "other", SchemaVersionKey: "1", ContentTypeKey: JSON.ContentType()},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTestRegistry().Decode("test", []byte(tt.data), tt.attributes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.(*testEvent).UserID != tt.want {
+				t.Errorf("Decode() = %+v, want user %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/outbox"
+)
+
+const outboxTable = "outbox"
+
+// failedOutboxTable holds the events moved aside after failing to publish too many times.
+const failedOutboxTable = "outbox_failed"
+
+type outboxEvent struct {
+	Topic      string
+	Attributes string `datastore:",noindex"`
+	Data       string `datastore:",noindex"`
+	CreatedAt  time.Time
+	// Attempts is the number of failed attempts to publish the event.
+	Attempts int `datastore:",noindex"`
+}
+
+// Add writes the events to the outbox as part of the transaction.
+func Add(tx *datastore.Transaction, events ...*outbox.Event) error {
+	for _, event := range events {
+		attributes, err := json.Marshal(event.Attributes)
+		if err != nil {
+			return errors.Wrap(err, "couldn't encode event attributes")
+		}
+
+		_, err = tx.Put(datastore.NameKey(outboxTable, event.ID, nil), &outboxEvent{
+			Topic:      event.Topic,
+			Attributes: string(attributes),
+			Data:       event.Data,
+			CreatedAt:  event.CreatedAt,
+		})
+		if err != nil {
+			return errors.Wrap(err, "couldn't put outbox event")
+		}
+	}
+
+	return nil
+}
+
+type store struct {
+	ds *datastore.Client
+}
+
+// NewStore creates an outbox Store backed by Datastore, sent events are deleted.
+func NewStore(ds *datastore.Client) outbox.Store {
+	return &store{
+		ds: ds,
+	}
+}
+
+func (s *store) Pending(ctx context.Context, limit int) ([]*outbox.Event, error) {
+	var out []*outboxEvent
+	keys, err := s.ds.GetAll(ctx, datastore.NewQuery(outboxTable).Order("CreatedAt").Limit(limit), &out)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get outbox events")
+	}
+
+	pending := make([]*outbox.Event, len(out))
+	for i := range out {
+		attributes := make(map[string]string)
+		err := json.Unmarshal([]byte(out[i].Attributes), &attributes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't decode attributes of outbox event %v", keys[i].Name)
+		}
+
+		pending[i] = &outbox.Event{
+			ID:         keys[i].Name,
+			Topic:      out[i].Topic,
+			Attributes: attributes,
+			Data:       out[i].Data,
+			CreatedAt:  out[i].CreatedAt,
+		}
+	}
+
+	return pending, nil
+}
+
+func (s *store) MarkSent(ctx context.Context, id string) error {
+	err := s.ds.Delete(ctx, datastore.NameKey(outboxTable, id, nil))
+	if err != nil {
+		return errors.Wrap(err, "couldn't delete outbox event")
+	}
+
+	return nil
+}
+
+func (s *store) RecordFailure(ctx context.Context, id string) (int, error) {
+	key := datastore.NameKey(outboxTable, id, nil)
+	var attempts int
+	_, err := s.ds.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		event := &outboxEvent{}
+		err := tx.Get(key, event)
+		if err != nil {
+			return errors.Wrap(err, "couldn't get outbox event")
+		}
+
+		event.Attempts++
+		attempts = event.Attempts
+		_, err = tx.Put(key, event)
+		return err
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't update outbox event")
+	}
+
+	return attempts, nil
+}
+
+func (s *store) MarkFailed(ctx context.Context, id string) error {
+	key := datastore.NameKey(outboxTable, id, nil)
+	_, err := s.ds.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		event := &outboxEvent{}
+		err := tx.Get(key, event)
+		if err != nil {
+			return errors.Wrap(err, "couldn't get outbox event")
+		}
+
+		_, err = tx.Put(datastore.NameKey(failedOutboxTable, id, nil), event)
+		if err != nil {
+			return errors.Wrap(err, "couldn't put failed outbox event")
+		}
+		return tx.Delete(key)
+	})
+	if err != nil {
+		return errors.Wrap(err, "couldn't move outbox event aside")
+	}
+
+	return nil
+}
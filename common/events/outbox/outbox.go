@@ -0,0 +1,290 @@
+package outbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cube2222/grpc-utils/logger"
+	"github.com/cube2222/grpc-utils/requestid"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/cube2222/usos-notifier/common/events"
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/tracing"
+)
+
+// Event is an event waiting in the outbox, written in the transaction of the state change it's about.
+type Event struct {
+	ID         string
+	Topic      string
+	Attributes map[string]string
+	Data       string
+	CreatedAt  time.Time
+}
+
+// NewEvent encodes the typed event, saving the request ID and trace context of ctx with it.
+func NewEvent(ctx context.Context, topic string, metadata map[string]string, event interface{}) (*Event, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't generate outbox event id")
+	}
+
+	data, schemaAttributes, err := events.DefaultRegistry.Encode(event)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't encode event")
+	}
+
+	attributes := make(map[string]string, len(metadata)+len(schemaAttributes)+1)
+	for key, value := range metadata {
+		attributes[key] = value
+	}
+	for key, value := range schemaAttributes {
+		attributes[key] = value
+	}
+	if requestID, ok := ctx.Value(requestid.Key).(string); ok {
+		attributes[requestid.Key] = requestID
+	}
+	tracing.Inject(ctx, attributes)
+	// Relaying may publish the event more than once, subscribers deduplicate it using the event ID.
+	attributes[publisher.IdempotencyKey] = id.String()
+
+	return &Event{
+		ID:         id.String(),
+		Topic:      topic,
+		Attributes: attributes,
+		Data:       string(data),
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// Store holds the outbox events, added by storages inside of their transactions.
+type Store interface {
+	// Pending returns up to limit events which haven't been sent yet, oldest first.
+	Pending(ctx context.Context, limit int) ([]*Event, error)
+	MarkSent(ctx context.Context, id string) error
+	// RecordFailure counts a failed attempt to publish the event and returns the number of failed attempts so far.
+	RecordFailure(ctx context.Context, id string) (int, error)
+	// MarkFailed moves the event aside, it's kept for inspection but isn't pending anymore.
+	MarkFailed(ctx context.Context, id string) error
+}
+
+// Relay publishes the pending events from the outbox and marks them as sent.
+type Relay struct {
+	store       Store
+	publisher   *publisher.Publisher
+	interval    time.Duration
+	timeout     time.Duration
+	batchSize   int
+	maxAttempts int
+}
+
+func NewRelay(store Store, publisher *publisher.Publisher, interval, timeout time.Duration, batchSize, maxAttempts int) *Relay {
+	return &Relay{
+		store:       store,
+		publisher:   publisher,
+		interval:    interval,
+		timeout:     timeout,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Run relays pending events every interval until ctx is done, each pass taking at most timeout.
+func (r *Relay) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		// Interrupted events stay pending, they're published again with the same idempotency key.
+		passCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		err := r.RelayPending(passCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			logger.FromContext(ctx).Errorf("Couldn't relay outbox events: %v", err)
+		}
+
+		select {
+		case <-time.After(r.interval):
+		case <-ctx.Done():
+		}
+	}
+
+	return nil
+}
+
+// RelayPending publishes the pending events, in order for each ordering key. An event failing to publish holds up
+// the later events with its ordering key, until it's moved aside after maxAttempts failed attempts.
+func (r *Relay) RelayPending(ctx context.Context) error {
+	var firstErr error
+	failed := 0
+	// blocked are the ordering keys of events which failed in this pass.
+	blocked := make(map[string]bool)
+	for {
+		pending, err := r.store.Pending(ctx, r.batchSize)
+		if err != nil {
+			return errors.Wrap(err, "couldn't get pending events")
+		}
+
+		left := 0
+		for _, event := range pending {
+			key := r.publisher.OrderingKeyOf(event.Attributes)
+			if key != "" && blocked[key] {
+				left++
+				continue
+			}
+
+			err := r.publish(ctx, event)
+			if err != nil {
+				if ctx.Err() != nil {
+					// The pass timed out or the relay is stopping, it's not the event's fault.
+					return errors.Wrapf(err, "couldn't publish outbox event %v", event.ID)
+				}
+				failed++
+				if firstErr == nil {
+					firstErr = errors.Wrapf(err, "couldn't publish outbox event %v", event.ID)
+				}
+
+				movedAside, err := r.recordFailure(ctx, event, err)
+				if err != nil {
+					return err
+				}
+				if !movedAside {
+					left++
+					if key != "" {
+						blocked[key] = true
+					}
+				}
+				continue
+			}
+
+			err = r.store.MarkSent(ctx, event.ID)
+			if err != nil {
+				return errors.Wrapf(err, "couldn't mark outbox event %v as sent", event.ID)
+			}
+		}
+
+		// The next batch would start with the events left pending again.
+		if len(pending) < r.batchSize || left > 0 {
+			break
+		}
+	}
+
+	if failed > 0 {
+		return errors.Wrapf(firstErr, "couldn't publish %d outbox events", failed)
+	}
+	return nil
+}
+
+// recordFailure counts the failed attempt to publish the event and moves it aside after maxAttempts, reporting whether it did.
+func (r *Relay) recordFailure(ctx context.Context, event *Event, publishErr error) (bool, error) {
+	attempts, err := r.store.RecordFailure(ctx, event.ID)
+	if err != nil {
+		return false, errors.Wrapf(err, "couldn't record failure of outbox event %v", event.ID)
+	}
+	if attempts < r.maxAttempts {
+		return false, nil
+	}
+
+	err = r.store.MarkFailed(ctx, event.ID)
+	if err != nil {
+		return false, errors.Wrapf(err, "couldn't mark outbox event %v as failed", event.ID)
+	}
+	logger.FromContext(ctx).Errorf("Moved outbox event %v to %v aside after %d failed attempts: %v", event.ID, event.Topic, attempts, publishErr)
+
+	return true, nil
+}
+
+func (r *Relay) publish(ctx context.Context, event *Event) error {
+	attributes := make(map[string]string, len(event.Attributes))
+	for key, value := range event.Attributes {
+		attributes[key] = value
+	}
+
+	if requestID, ok := attributes[requestid.Key]; ok {
+		ctx = context.WithValue(ctx, requestid.Key, requestID)
+	}
+	ctx = tracing.Extract(ctx, attributes)
+
+	return r.publisher.PublishEvent(ctx, event.Topic, attributes, event.Data)
+}
+
+// MemoryStore is an in-memory outbox, useful for tests.
+type MemoryStore struct {
+	mu       sync.Mutex
+	events   map[string]*Event
+	attempts map[string]int
+	failed   []*Event
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		events:   make(map[string]*Event),
+		attempts: make(map[string]int),
+	}
+}
+
+// Add adds the events to the outbox.
+func (s *MemoryStore) Add(events ...*Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		s.events[event.ID] = event
+	}
+}
+
+func (s *MemoryStore) Pending(ctx context.Context, limit int) ([]*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := make([]*Event, 0, len(s.events))
+	for _, event := range s.events {
+		pending = append(pending, event)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	if len(pending) > limit {
+		pending = pending[:limit]
+	}
+
+	return pending, nil
+}
+
+func (s *MemoryStore) MarkSent(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, id)
+
+	return nil
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, id string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts[id]++
+
+	return s.attempts[id], nil
+}
+
+func (s *MemoryStore) MarkFailed(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event, ok := s.events[id]; ok {
+		s.failed = append(s.failed, event)
+		delete(s.events, id)
+	}
+
+	return nil
+}
+
+// Failed returns the events moved aside after failing to publish.
+func (s *MemoryStore) Failed() []*Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Event(nil), s.failed...)
+}
@@ -0,0 +1,191 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"github.com/cube2222/usos-notifier/common/events"
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/events/transport"
+	"github.com/cube2222/usos-notifier/common/events/transport/local"
+)
+
+func init() {
+	events.Register(&events.Schema{
+		Name:    "outbox_test",
+		Version: 1,
+		Codec:   events.Protobuf,
+		New: func() interface{} {
+			return &wrappers.StringValue{}
+		},
+	})
+}
+
+func TestRelay_RelayPending(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	broker := local.NewBroker(0)
+	broker.CreateTopic("known")
+	broker.CreateSubscription("sub", "known")
+
+	store := NewMemoryStore()
+	relay := NewRelay(store, publisher.NewPublisher(broker), time.Second, time.Second, 1, 10)
+
+	var added []*Event
+	for _, topic := range []string{"known", "unknown", "known"} {
+		event, err := NewEvent(ctx, topic, map[string]string{publisher.UserIDKey: "1"}, &wrappers.StringValue{Value: topic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Make sure the creation order is well defined.
+		event.CreatedAt = time.Unix(int64(len(added)), 0)
+		added = append(added, event)
+	}
+	store.Add(added...)
+
+	err := relay.RelayPending(ctx)
+	if err == nil {
+		t.Fatal("expected error when relaying to an unknown topic")
+	}
+
+	pending, err := store.Pending(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].ID != added[1].ID || pending[1].ID != added[2].ID {
+		t.Fatalf("events after the failed one should stay pending, got %+v", pending)
+	}
+
+	broker.CreateTopic("unknown")
+	err = relay.RelayPending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err = store.Pending(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected all events to be sent, got %+v", pending)
+	}
+
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	mutex := sync.Mutex{}
+	var received []*transport.Message
+	err = broker.Receive(ctx, "sub", transport.ReceiveSettings{}, func(ctx context.Context, msg *transport.Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		received = append(received, msg)
+		msg.Ack()
+		if len(received) == 2 {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, msg := range received {
+		if msg.Attributes[publisher.IdempotencyKey] != added[2*i].ID {
+			t.Errorf("message %d has idempotency key %v, want %v", i, msg.Attributes[publisher.IdempotencyKey], added[2*i].ID)
+		}
+	}
+}
+
+// blockingStore hangs until the context is done, like an unreachable Datastore.
+type blockingStore struct{}
+
+func (blockingStore) Pending(ctx context.Context, limit int) ([]*Event, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (blockingStore) MarkSent(ctx context.Context, id string) error {
+	return nil
+}
+
+func (blockingStore) RecordFailure(ctx context.Context, id string) (int, error) {
+	return 0, nil
+}
+
+func (blockingStore) MarkFailed(ctx context.Context, id string) error {
+	return nil
+}
+
+func TestRelay_Run(t *testing.T) {
+	relay := NewRelay(blockingStore{}, publisher.NewPublisher(local.NewBroker(0)), time.Millisecond, time.Hour, 1, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- relay.Run(ctx)
+	}()
+
+	time.Sleep(time.Millisecond * 10)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("relay didn't stop on shutdown")
+	}
+}
+
+func TestRelay_RelayPending_FailingEvent(t *testing.T) {
+	ctx := context.Background()
+
+	broker := local.NewBroker(0)
+	broker.CreateTopic("known")
+
+	store := NewMemoryStore()
+	relay := NewRelay(store, publisher.NewPublisher(broker), time.Second, time.Second, 10, 2)
+
+	var added []*Event
+	for _, e := range []struct{ topic, userID string }{{"deleted", "1"}, {"known", "1"}, {"known", "2"}, {"known", "3"}} {
+		event, err := NewEvent(ctx, e.topic, map[string]string{publisher.UserIDKey: e.userID}, &wrappers.StringValue{Value: e.topic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		event.CreatedAt = time.Unix(int64(len(added)), 0)
+		added = append(added, event)
+	}
+	store.Add(added...)
+
+	// Only the later event of the same user waits for the failing one.
+	if err := relay.RelayPending(ctx); err == nil {
+		t.Fatal("expected error when relaying to a deleted topic")
+	}
+	pending, err := store.Pending(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].ID != added[0].ID || pending[1].ID != added[1].ID {
+		t.Fatalf("expected the events of user 1 to stay pending, got %+v", pending)
+	}
+
+	// The failing event is moved aside after 2 attempts, letting the later one through.
+	if err := relay.RelayPending(ctx); err == nil {
+		t.Fatal("expected error when relaying to a deleted topic")
+	}
+	pending, err = store.Pending(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending events, got %+v", pending)
+	}
+	if failed := store.Failed(); len(failed) != 1 || failed[0].ID != added[0].ID {
+		t.Errorf("expected the failing event to be moved aside, got %+v", failed)
+	}
+}
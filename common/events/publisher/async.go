@@ -0,0 +1,162 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Result is the handle of an event being published asynchronously.
+type Result struct {
+	done chan struct{}
+	err  error
+}
+
+// Ready is closed once the event has been published, or publishing it failed.
+func (r *Result) Ready() <-chan struct{} {
+	return r.done
+}
+
+// Get waits for the event to be published and returns the publishing error, if any.
+func (r *Result) Get(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "couldn't wait for event to be published")
+	}
+}
+
+// outstanding tracks the events being published asynchronously.
+type outstanding struct {
+	mu      sync.Mutex
+	count   int
+	stopped bool
+	// idle is closed when the count drops to zero.
+	idle chan struct{}
+	// last holds the last event of each ordering key, the next one is published after it.
+	last map[string]*Result
+}
+
+// add starts tracking the event, returning the one it has to wait for, or false if stopped.
+func (o *outstanding) add(orderingKey string, res *Result) (*Result, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.stopped {
+		return nil, false
+	}
+	if o.count == 0 {
+		o.idle = make(chan struct{})
+	}
+	o.count++
+
+	if orderingKey == "" {
+		return nil, true
+	}
+	if o.last == nil {
+		o.last = make(map[string]*Result)
+	}
+	previous := o.last[orderingKey]
+	o.last[orderingKey] = res
+
+	return previous, true
+}
+
+func (o *outstanding) done(orderingKey string, res *Result) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if orderingKey != "" && o.last[orderingKey] == res {
+		delete(o.last, orderingKey)
+	}
+	o.count--
+	if o.count == 0 {
+		close(o.idle)
+	}
+}
+
+func (o *outstanding) stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.stopped = true
+}
+
+func (o *outstanding) isStopped() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.stopped
+}
+
+func (o *outstanding) wait(ctx context.Context) error {
+	o.mu.Lock()
+	if o.count == 0 {
+		o.mu.Unlock()
+		return nil
+	}
+	idle := o.idle
+	o.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "couldn't wait for outstanding events to be published")
+	}
+}
+
+// PublishEventAsync publishes the event in the background after earlier events with its ordering key, use Flush to wait for it.
+func (p *Publisher) PublishEventAsync(ctx context.Context, eventType string, metadata map[string]string, message string) *Result {
+	attributes := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		attributes[key] = value
+	}
+
+	return p.async(ctx, p.OrderingKeyOf(attributes), func(ctx context.Context) error {
+		return p.publish(ctx, eventType, attributes, message)
+	})
+}
+
+// PublishTypedAsync is the asynchronous version of PublishTyped, see PublishEventAsync.
+func (p *Publisher) PublishTypedAsync(ctx context.Context, eventType string, metadata map[string]string, event interface{}) *Result {
+	attributes := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		attributes[key] = value
+	}
+
+	return p.async(ctx, p.OrderingKeyOf(attributes), func(ctx context.Context) error {
+		return p.publishTyped(ctx, eventType, attributes, event)
+	})
+}
+
+func (p *Publisher) async(ctx context.Context, orderingKey string, publish func(ctx context.Context) error) *Result {
+	res := &Result{
+		done: make(chan struct{}),
+	}
+	previous, ok := p.outstanding.add(orderingKey, res)
+	if !ok {
+		res.err = ErrStopped
+		close(res.done)
+		return res
+	}
+
+	go func() {
+		defer p.outstanding.done(orderingKey, res)
+		defer close(res.done)
+
+		if previous != nil {
+			<-previous.done
+		}
+		res.err = publish(context.WithoutCancel(ctx))
+	}()
+
+	return res
+}
+
+// Flush waits until all the events published asynchronously so far have been published.
+func (p *Publisher) Flush(ctx context.Context) error {
+	return p.outstanding.wait(ctx)
+}
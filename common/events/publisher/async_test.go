@@ -0,0 +1,152 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"github.com/cube2222/usos-notifier/common/events"
+	"github.com/cube2222/usos-notifier/common/events/transport/local"
+)
+
+func TestPublisher_PublishEventAsync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	broker := local.NewBroker(0)
+	broker.CreateTopic("events")
+	pub := NewPublisher(broker)
+
+	var results []*Result
+	for i := 0; i < 50; i++ {
+		results = append(results, pub.PublishEventAsync(ctx, "events", nil, fmt.Sprint(i)))
+	}
+	unknown := pub.PublishEventAsync(ctx, "unknown", nil, "hello")
+
+	if err := pub.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, res := range results {
+		select {
+		case <-res.Ready():
+		default:
+			t.Fatalf("result %d not ready after flush", i)
+		}
+		if err := res.Get(ctx); err != nil {
+			t.Errorf("result %d: %v", i, err)
+		}
+	}
+	if err := unknown.Get(ctx); err == nil {
+		t.Error("expected error when publishing to an unknown topic")
+	}
+}
+
+// slowTransport takes a random time to publish, recording the order messages were published in.
+type slowTransport struct {
+	mu        sync.Mutex
+	published []string
+	userIDs   []string
+}
+
+func (t *slowTransport) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) (string, error) {
+	time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.published = append(t.published, string(data))
+	t.userIDs = append(t.userIDs, attributes[UserIDKey])
+	return fmt.Sprint(len(t.published)), nil
+}
+
+func TestPublisher_PublishEventAsync_Ordering(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	tr := &slowTransport{}
+	pub := NewPublisher(tr).WithContentEncoding(events.ContentEncodingRaw)
+
+	var want []string
+	for i := 0; i < 20; i++ {
+		want = append(want, fmt.Sprint(i))
+		pub.PublishEventAsync(ctx, "events", map[string]string{UserIDKey: "1"}, fmt.Sprint(i))
+	}
+	if err := pub.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(tr.published) != fmt.Sprint(want) {
+		t.Errorf("published %v, want %v", tr.published, want)
+	}
+}
+
+func TestPublisher_StopWhilePublishingAsync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	pub := NewPublisher(&slowTransport{})
+
+	var wg sync.WaitGroup
+	results := make(chan *Result, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results <- pub.PublishEventAsync(ctx, "events", map[string]string{UserIDKey: fmt.Sprint(i % 5)}, "hello")
+		}(i)
+	}
+	if err := pub.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	close(results)
+
+	// Events accepted before Stop have been published by the time it returns, the others have been rejected.
+	for res := range results {
+		select {
+		case <-res.Ready():
+		default:
+			t.Error("event accepted, but not published by the time Stop returned")
+		}
+	}
+}
+
+func TestPublisher_PublishTypedAsync_CopiesMetadata(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	registry := events.NewRegistry()
+	registry.Register(&events.Schema{
+		Name:    "async_test",
+		Version: 1,
+		Codec:   events.Protobuf,
+		New: func() interface{} {
+			return &wrappers.StringValue{}
+		},
+	})
+	tr := &slowTransport{}
+	pub := NewPublisher(tr).WithRegistry(registry)
+
+	// The caller reuses the metadata right after publishing.
+	metadata := map[string]string{}
+	for i := 0; i < 10; i++ {
+		metadata[UserIDKey] = fmt.Sprint(i)
+		pub.PublishTypedAsync(ctx, "events", metadata, &wrappers.StringValue{Value: "hello"})
+	}
+	if err := pub.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	published := map[string]bool{}
+	for _, userID := range tr.userIDs {
+		published[userID] = true
+	}
+	if len(published) != 10 {
+		t.Errorf("expected events of 10 users, got %v", tr.userIDs)
+	}
+}
@@ -0,0 +1,41 @@
+package publisher
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/cube2222/usos-notifier/common/metrics"
+)
+
+var (
+	publishedEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_published_total",
+			Help: "Number of events published, by topic and outcome.",
+		},
+		[]string{"topic", "outcome"},
+	)
+	publishDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "events_publish_duration_seconds",
+			Help:    "Time it took to publish events, by topic.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"topic"},
+	)
+)
+
+func WithMetrics(next PublishEventFunc) PublishEventFunc {
+	return func(ctx context.Context, eventType string, metadata map[string]string, message string) error {
+		start := time.Now()
+		err := next(ctx, eventType, metadata, message)
+
+		publishDuration.WithLabelValues(eventType).Observe(time.Since(start).Seconds())
+		publishedEvents.WithLabelValues(eventType, metrics.Outcome(err)).Inc()
+
+		return err
+	}
+}
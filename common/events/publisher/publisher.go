@@ -2,34 +2,113 @@ package publisher
 
 import (
 	"context"
-	"encoding/base64"
 
-	"cloud.google.com/go/pubsub"
 	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/cube2222/usos-notifier/common/events"
+	"github.com/cube2222/usos-notifier/common/events/transport"
 )
 
+// TopicKey is the attribute holding the topic the event was published to.
+const TopicKey = "topic"
+
+// IdempotencyKey is the attribute identifying an event for deduplication, generated unless provided.
+const IdempotencyKey = "idempotency_key"
+
+// UserIDKey is the attribute holding the ID of the user the event concerns.
+const UserIDKey = "user_id"
+
+// OriginKey is the attribute holding where the event originated from, like fb_messenger.
+const OriginKey = "origin"
+
+// OrderingKey is the attribute holding the ordering key, taken from the ordering attribute unless provided.
+const OrderingKey = transport.OrderingKey
+
 type PublishEventFunc func(ctx context.Context, eventType string, metadata map[string]string, message string) error
 type PublishMiddleware func(f PublishEventFunc) PublishEventFunc
 
+var ErrStopped = errors.New("publisher stopped")
+
+// Publisher publishes events through the middleware, it's safe for concurrent use once configured.
 type Publisher struct {
-	pubsub     *pubsub.Client
-	topics     map[string]*pubsub.Topic
-	middleware []PublishMiddleware
+	transport         transport.Publisher
+	registry          *events.Registry
+	orderingAttribute string
+	contentEncoding   string
+	middleware        []PublishMiddleware
+	outstanding       outstanding
 }
 
-func NewPublisher(cli *pubsub.Client) *Publisher {
+func NewPublisher(transport transport.Publisher) *Publisher {
 	return &Publisher{
-		pubsub:     cli,
-		topics:     make(map[string]*pubsub.Topic),
-		middleware: []PublishMiddleware{},
+		transport:         transport,
+		registry:          events.DefaultRegistry,
+		orderingAttribute: UserIDKey,
+		contentEncoding:   events.ContentEncodingBase64,
+		middleware:        []PublishMiddleware{},
 	}
 }
 
+// WithRegistry sets the registry used to encode typed events, the default registry is used otherwise.
+func (p *Publisher) WithRegistry(registry *events.Registry) *Publisher {
+	p.registry = registry
+	return p
+}
+
+// WithOrderingAttribute sets the attribute used as the ordering key of events, the user ID by default.
+func (p *Publisher) WithOrderingAttribute(attribute string) *Publisher {
+	p.orderingAttribute = attribute
+	return p
+}
+
+// WithContentEncoding sets how payloads are encoded for transport, base64 by default.
+func (p *Publisher) WithContentEncoding(encoding string) *Publisher {
+	p.contentEncoding = encoding
+	return p
+}
+
+// PublishTyped encodes the event using its registered schema and publishes it with the schema attributes.
+func (p *Publisher) PublishTyped(ctx context.Context, eventType string, metadata map[string]string, event interface{}) error {
+	if p.outstanding.isStopped() {
+		return ErrStopped
+	}
+
+	return p.publishTyped(ctx, eventType, metadata, event)
+}
+
+func (p *Publisher) publishTyped(ctx context.Context, eventType string, metadata map[string]string, event interface{}) error {
+	data, schemaAttributes, err := p.registry.Encode(event)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode event")
+	}
+
+	attributes := make(map[string]string, len(metadata)+len(schemaAttributes))
+	for key, value := range metadata {
+		attributes[key] = value
+	}
+	for key, value := range schemaAttributes {
+		attributes[key] = value
+	}
+
+	return p.publish(ctx, eventType, attributes, string(data))
+}
+
 func (p *Publisher) PublishEvent(ctx context.Context, eventType string, metadata map[string]string, message string) error {
-	if metadata == nil {
-		metadata = make(map[string]string)
+	if p.outstanding.isStopped() {
+		return ErrStopped
+	}
+
+	attributes := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		attributes[key] = value
 	}
 
+	return p.publish(ctx, eventType, attributes, message)
+}
+
+// publish passes the event through the middleware, the metadata must be owned by this call.
+func (p *Publisher) publish(ctx context.Context, eventType string, metadata map[string]string, message string) error {
 	publisher := p.publishEvent
 
 	for i := len(p.middleware) - 1; i >= 0; i-- {
@@ -40,24 +119,42 @@ func (p *Publisher) PublishEvent(ctx context.Context, eventType string, metadata
 }
 
 func (p *Publisher) publishEvent(ctx context.Context, eventType string, metadata map[string]string, message string) error {
-	res := p.getTopic(eventType).Publish(ctx, &pubsub.Message{
-		Data:       []byte(base64.StdEncoding.EncodeToString([]byte(message))),
-		Attributes: metadata,
-	})
+	metadata[TopicKey] = eventType
+	if _, ok := metadata[IdempotencyKey]; !ok {
+		key, err := uuid.NewV4()
+		if err != nil {
+			return errors.Wrap(err, "couldn't generate idempotency key")
+		}
+		metadata[IdempotencyKey] = key.String()
+	}
+	if key := p.OrderingKeyOf(metadata); key != "" {
+		metadata[OrderingKey] = key
+	}
 
-	_, err := res.Get(ctx)
+	data, err := events.EncodePayload(p.contentEncoding, []byte(message))
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode payload")
+	}
+	metadata[events.ContentEncodingKey] = p.contentEncoding
+
+	_, err = p.transport.Publish(ctx, eventType, data, metadata)
 
 	return errors.Wrapf(err, "couldn't publish event of type %v", eventType)
 }
 
-func (p *Publisher) getTopic(topic string) *pubsub.Topic {
-	t, ok := p.topics[topic]
-	if !ok {
-		t = p.pubsub.Topic(topic)
-		p.topics[topic] = t
+// OrderingKeyOf returns the ordering key an event with the metadata gets published with, empty if none.
+func (p *Publisher) OrderingKeyOf(metadata map[string]string) string {
+	if key, ok := metadata[OrderingKey]; ok {
+		return key
 	}
+	return metadata[p.orderingAttribute]
+}
+
+// Stop waits for the events being published asynchronously, publishing fails afterwards.
+func (p *Publisher) Stop(ctx context.Context) error {
+	p.outstanding.stop()
 
-	return t
+	return p.Flush(ctx)
 }
 
 func (p *Publisher) Use(f PublishMiddleware) *Publisher {
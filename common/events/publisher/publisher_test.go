@@ -0,0 +1,55 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/events/transport/local"
+)
+
+func TestPublisher_ConcurrentPublish(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	broker := local.NewBroker(0)
+	broker.CreateTopic("events")
+	pub := NewPublisher(broker).Use(WithRequestID)
+
+	// The metadata is shared between all publishes, it mustn't be modified.
+	metadata := map[string]string{UserIDKey: "user"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				if err := pub.PublishEvent(ctx, "events", metadata, fmt.Sprint(i)); err != nil {
+					t.Error(err)
+				}
+				return
+			}
+			if err := pub.PublishEventAsync(ctx, "events", metadata, fmt.Sprint(i)).Get(ctx); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(metadata) != 1 {
+		t.Errorf("metadata has been modified: %v", metadata)
+	}
+
+	if err := pub.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := pub.PublishEvent(ctx, "events", nil, "hello"); err != ErrStopped {
+		t.Errorf("expected ErrStopped, got %v", err)
+	}
+	if err := pub.PublishEventAsync(ctx, "events", nil, "hello").Get(ctx); err != ErrStopped {
+		t.Errorf("expected ErrStopped from async publish, got %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package publisher
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cube2222/usos-notifier/common/tracing"
+)
+
+// WithTracing starts a producer span for each published event and propagates it in the event attributes.
+func WithTracing(next PublishEventFunc) PublishEventFunc {
+	return func(ctx context.Context, eventType string, metadata map[string]string, message string) (err error) {
+		ctx, span := tracing.StartSpan(
+			ctx,
+			"publish "+eventType,
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(attribute.String("messaging.destination", eventType)),
+		)
+		defer func() {
+			tracing.End(span, err)
+		}()
+
+		tracing.Inject(ctx, metadata)
+
+		return next(ctx, eventType, metadata, message)
+	}
+}
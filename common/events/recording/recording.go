@@ -0,0 +1,205 @@
+package recording
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/cube2222/grpc-utils/requestid"
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/events/subscriber"
+)
+
+// FileRecorder records handled messages as JSON lines, rotating the file to path.1, path.2 and so on.
+type FileRecorder struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileRecorder creates a recorder appending to the file at path. An empty path disables recording.
+func NewFileRecorder(path string, maxSize int64, maxFiles int) (*FileRecorder, error) {
+	r := &FileRecorder{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if path == "" {
+		return r, nil
+	}
+
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *FileRecorder) Record(ctx context.Context, msg *subscriber.RecordedMessage) error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode recorded message")
+	}
+	data = append(data, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(data)) > r.maxSize {
+		err := r.rotate()
+		if err != nil {
+			return errors.Wrap(err, "couldn't rotate recording file")
+		}
+	}
+
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "couldn't write recorded message")
+	}
+
+	return nil
+}
+
+// Close closes the current recording file.
+func (r *FileRecorder) Close() error {
+	if r.path == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return errors.Wrap(r.file.Close(), "couldn't close recording file")
+}
+
+func (r *FileRecorder) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open recording file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "couldn't stat recording file")
+	}
+
+	r.file = file
+	r.size = info.Size()
+
+	return nil
+}
+
+func (r *FileRecorder) rotate() error {
+	err := r.file.Close()
+	if err != nil {
+		return errors.Wrap(err, "couldn't close recording file")
+	}
+
+	for i := r.maxFiles - 1; i > 0; i-- {
+		from := rotatedPath(r.path, i-1)
+		err := os.Rename(from, rotatedPath(r.path, i))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "couldn't rename %v", from)
+		}
+	}
+	if r.maxFiles <= 1 {
+		err := os.Remove(r.path)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "couldn't remove recording file")
+		}
+	}
+
+	return r.open()
+}
+
+func rotatedPath(path string, i int) string {
+	if i == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// Filter selects recorded messages. Empty fields match everything.
+type Filter struct {
+	RequestID string
+	UserID    string
+	Handler   string
+	Outcome   string
+}
+
+func (f *Filter) Matches(msg *subscriber.RecordedMessage) bool {
+	return (f.RequestID == "" || msg.Attributes[requestid.Key] == f.RequestID) &&
+		(f.UserID == "" || msg.Attributes[publisher.UserIDKey] == f.UserID) &&
+		(f.Handler == "" || msg.Handler == f.Handler) &&
+		(f.Outcome == "" || msg.Outcome == f.Outcome)
+}
+
+// ReadFiles reads the messages recorded at path, including the rotated files, oldest first.
+func ReadFiles(path string, filter *Filter) ([]*subscriber.RecordedMessage, error) {
+	var rotated []string
+	for i := 1; ; i++ {
+		_, err := os.Stat(rotatedPath(path, i))
+		if os.IsNotExist(err) {
+			break
+		}
+		rotated = append(rotated, rotatedPath(path, i))
+	}
+
+	var out []*subscriber.RecordedMessage
+	for i := len(rotated) - 1; i >= 0; i-- {
+		msgs, err := readFile(rotated[i], filter)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, msgs...)
+	}
+	msgs, err := readFile(path, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, msgs...), nil
+}
+
+func readFile(path string, filter *Filter) ([]*subscriber.RecordedMessage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't open recording file")
+	}
+	defer file.Close()
+
+	var out []*subscriber.RecordedMessage
+	scanner := bufio.NewScanner(file)
+	// Messages may be larger than the default token size.
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		msg := &subscriber.RecordedMessage{}
+		err := json.Unmarshal(scanner.Bytes(), msg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't decode recorded message in %v", path)
+		}
+		if filter.Matches(msg) {
+			out = append(out, msg)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "couldn't read %v", path)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,77 @@
+package recording
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cube2222/grpc-utils/requestid"
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/subscriber"
+)
+
+func TestFileRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	recorder, err := NewFileRecorder(path, 512, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := subscriber.Chain(
+		func(ctx context.Context, msg *subscriber.Message) error {
+			if string(msg.Data) == "fail" {
+				return errors.New("usos is down")
+			}
+			return nil
+		},
+		subscriber.WithRecording(recorder, "test.Handler"),
+	)
+
+	for i := 0; i < 20; i++ {
+		data := "ok"
+		if i == 19 {
+			data = "fail"
+		}
+		err := handler(context.Background(), &subscriber.Message{
+			ID:         fmt.Sprint(i),
+			Data:       []byte(data),
+			Attributes: map[string]string{requestid.Key: fmt.Sprint(i % 2)},
+		})
+		if i == 19 && err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Errorf("expected the recording to be rotated: %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 3 recording files")
+	}
+
+	msgs, err := ReadFiles(path, &Filter{RequestID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) == 0 {
+		t.Fatal("expected recorded messages")
+	}
+	last := msgs[len(msgs)-1]
+	if last.MessageID != "19" || last.Outcome != "nack" || last.Error != "usos is down" || last.Handler != "test.Handler" {
+		t.Errorf("unexpected last message %+v", last)
+	}
+	for i := 1; i < len(msgs); i++ {
+		if msgs[i].Time.Before(msgs[i-1].Time) {
+			t.Errorf("messages should be ordered oldest first")
+		}
+		if msgs[i].Attributes[requestid.Key] != "1" {
+			t.Errorf("message %v doesn't match the filter", msgs[i].MessageID)
+		}
+	}
+}
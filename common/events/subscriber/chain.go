@@ -0,0 +1,36 @@
+package subscriber
+
+import (
+	"github.com/cube2222/grpc-utils/logger"
+	"github.com/cube2222/grpc-utils/requestid"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+// ChainDeps are the dependencies of the default middleware chain, shared by all subscriptions of a service.
+type ChainDeps struct {
+	Logger          logger.Logger
+	Recorder        Recorder
+	SeenStore       SeenStore
+	DeadLetter      transport.Publisher
+	DeadLetterTopic string
+	Retry           RetryConfig
+}
+
+// DefaultChain returns the middleware every subscription handler goes through, in order.
+func DefaultChain(handlerName string, deps ChainDeps, maxConcurrency int) []HandlerMiddleware {
+	return []HandlerMiddleware{
+		WithLogger(deps.Logger),
+		WithRequestID,
+		WithTracing(handlerName),
+		WithLogFields(requestid.Key, publisher.UserIDKey, publisher.OriginKey),
+		WithLogging(requestid.Key),
+		WithMetrics(handlerName),
+		WithRecording(deps.Recorder, handlerName),
+		WithDeduplication(deps.SeenStore, handlerName),
+		WithDeadLetter(deps.DeadLetter, deps.DeadLetterTopic, handlerName),
+		WithRetry(deps.Retry),
+		WithMaxConcurrency(maxConcurrency),
+	}
+}
@@ -0,0 +1,55 @@
+package datastore
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/subscriber"
+)
+
+const seenMessagesTable = "seen_messages"
+
+type seenMessage struct {
+	SeenAt time.Time
+}
+
+type seenStore struct {
+	ds        *datastore.Client
+	retention time.Duration
+}
+
+// NewSeenStore creates a SeenStore backed by Datastore, forgetting messages seen longer than retention ago.
+func NewSeenStore(ds *datastore.Client, retention time.Duration) subscriber.SeenStore {
+	return &seenStore{
+		ds:        ds,
+		retention: retention,
+	}
+}
+
+func (s *seenStore) IsSeen(ctx context.Context, key string) (bool, error) {
+	out := seenMessage{}
+
+	err := s.ds.Get(ctx, datastore.NameKey(seenMessagesTable, key, nil), &out)
+	if err != nil {
+		if err == datastore.ErrNoSuchEntity {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "couldn't get seen message")
+	}
+
+	return time.Since(out.SeenAt) < s.retention, nil
+}
+
+func (s *seenStore) MarkSeen(ctx context.Context, key string) error {
+	_, err := s.ds.Put(ctx, datastore.NameKey(seenMessagesTable, key, nil), &seenMessage{
+		SeenAt: time.Now(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "couldn't put seen message")
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package subscriber
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+// Attributes added to messages republished to the dead letter topic.
+const (
+	DeadLetterErrorKey           = "dead_letter_error"
+	DeadLetterHandlerKey         = "dead_letter_handler"
+	DeadLetterDeliveryAttemptKey = "dead_letter_delivery_attempt"
+	DeadLetterMessageIDKey       = "dead_letter_message_id"
+	DeadLetterTimeKey            = "dead_letter_time"
+)
+
+// WithDeadLetter republishes permanently failed messages to the dead letter topic, use it last but before WithRetry.
+func WithDeadLetter(pub transport.Publisher, topic, handlerName string) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			err := next(ctx, msg)
+			if err == nil || !IsNonRetryableError(err) {
+				return err
+			}
+
+			attributes := make(map[string]string, len(msg.Attributes)+5)
+			for key, value := range msg.Attributes {
+				attributes[key] = value
+			}
+			attributes[DeadLetterErrorKey] = err.Error()
+			attributes[DeadLetterHandlerKey] = handlerName
+			attributes[DeadLetterDeliveryAttemptKey] = strconv.Itoa(msg.DeliveryAttempt)
+			attributes[DeadLetterMessageIDKey] = msg.ID
+			attributes[DeadLetterTimeKey] = time.Now().Format(time.RFC3339)
+
+			_, pubErr := pub.Publish(ctx, topic, msg.Data, attributes)
+			if pubErr != nil {
+				// Better to retry the message than to lose it.
+				return errors.Wrapf(pubErr, "couldn't publish message to dead letter topic after permanent error: %v", err)
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package subscriber
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type recordingPublisher struct {
+	topic      string
+	data       []byte
+	attributes map[string]string
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) (string, error) {
+	p.topic = topic
+	p.data = data
+	p.attributes = attributes
+	return "1", nil
+}
+
+func TestWithDeadLetter(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantDeadLetter bool
+	}{
+		{
+			name:           "With a permanent error, I want the message dead lettered",
+			err:            NewNonRetryableError(errors.New("broken")),
+			wantDeadLetter: true,
+		},
+		{
+			name:           "With a retryable error, I want the message left alone",
+			err:            errors.New("broken"),
+			wantDeadLetter: false,
+		},
+		{
+			name:           "With no error, I want the message left alone",
+			err:            nil,
+			wantDeadLetter: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{}
+			handler := Chain(
+				func(ctx context.Context, msg *Message) error {
+					return tt.err
+				},
+				WithDeadLetter(pub, "dead_letter", "test.Handler"),
+			)
+
+			err := handler(context.Background(), &Message{
+				ID:              "42",
+				Data:            []byte("data"),
+				Attributes:      map[string]string{"user_id": "1"},
+				DeliveryAttempt: 3,
+			})
+			if err != tt.err {
+				t.Errorf("handler error = %v, want %v", err, tt.err)
+			}
+
+			if (pub.topic != "") != tt.wantDeadLetter {
+				t.Fatalf("dead lettered = %v, want %v", pub.topic != "", tt.wantDeadLetter)
+			}
+			if !tt.wantDeadLetter {
+				return
+			}
+			if pub.topic != "dead_letter" || string(pub.data) != "data" {
+				t.Errorf("published %s to %v", pub.data, pub.topic)
+			}
+			want := map[string]string{
+				"user_id":                    "1",
+				DeadLetterErrorKey:           tt.err.Error(),
+				DeadLetterHandlerKey:         "test.Handler",
+				DeadLetterDeliveryAttemptKey: "3",
+				DeadLetterMessageIDKey:       "42",
+			}
+			for key, value := range want {
+				if pub.attributes[key] != value {
+					t.Errorf("attribute %v = %v, want %v", key, pub.attributes[key], value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package subscriber
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cube2222/grpc-utils/logger"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+)
+
+// ReplayHandlerKey is the attribute naming the only handler a replayed message is meant for.
+const ReplayHandlerKey = "replay_handler"
+
+// ReplayAttributes returns the attributes to replay a message handled by handler with, so only that handler handles it.
+// It gets a new idempotency key, unless keepIdempotencyKey is set, as the message has been marked as handled.
+func ReplayAttributes(attributes map[string]string, handler string, keepIdempotencyKey bool) (map[string]string, error) {
+	out := make(map[string]string, len(attributes)+2)
+	for key, value := range attributes {
+		out[key] = value
+	}
+	if handler != "" {
+		out[ReplayHandlerKey] = handler
+	}
+	if !keepIdempotencyKey {
+		key, err := uuid.NewV4()
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't generate idempotency key")
+		}
+		out[publisher.IdempotencyKey] = key.String()
+	}
+
+	return out, nil
+}
+
+// SeenStore remembers which messages have already been handled.
+type SeenStore interface {
+	IsSeen(ctx context.Context, key string) (bool, error)
+	MarkSeen(ctx context.Context, key string) error
+}
+
+// WithDeduplication skips messages this handler has already handled or which were replayed to another handler.
+func WithDeduplication(store SeenStore, handlerName string) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			if target, ok := msg.Attributes[ReplayHandlerKey]; ok && target != handlerName {
+				logger.FromContext(ctx).Printf("Skipping message replayed to %v.", target)
+				return nil
+			}
+
+			id, ok := msg.Attributes[publisher.IdempotencyKey]
+			if !ok {
+				id = msg.ID
+			}
+			key := fmt.Sprintf("%s/%s", handlerName, id)
+
+			seen, err := store.IsSeen(ctx, key)
+			if err != nil {
+				return errors.Wrap(err, "couldn't check if message has already been handled")
+			}
+			if seen {
+				logger.FromContext(ctx).Printf("Skipping already handled message %v.", key)
+				return nil
+			}
+
+			err = next(ctx, msg)
+			if err != nil && !IsNonRetryableError(err) {
+				return err
+			}
+
+			markErr := store.MarkSeen(ctx, key)
+			if markErr != nil {
+				logger.FromContext(ctx).Errorf("Couldn't mark message %v as handled: %v", key, markErr)
+			}
+
+			return err
+		}
+	}
+}
+
+type memorySeenStore struct {
+	size int
+
+	mutex sync.Mutex
+	// The most recently seen key is at the front.
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+// NewMemorySeenStore creates a SeenStore remembering up to size most recently seen messages.
+func NewMemorySeenStore(size int) SeenStore {
+	return &memorySeenStore{
+		size:     size,
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+func (s *memorySeenStore) IsSeen(ctx context.Context, key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.elements[key]
+	return ok, nil
+}
+
+func (s *memorySeenStore) MarkSeen(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if element, ok := s.elements[key]; ok {
+		s.order.MoveToFront(element)
+		return nil
+	}
+
+	s.elements[key] = s.order.PushFront(key)
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.elements, oldest.Value.(string))
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package subscriber
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+)
+
+func TestWithDeduplication(t *testing.T) {
+	calls := 0
+	fail := true
+	handler := Chain(
+		func(ctx context.Context, msg *Message) error {
+			calls++
+			if fail {
+				return errors.New("messenger is down")
+			}
+			return nil
+		},
+		WithDeduplication(NewMemorySeenStore(10), "test.Handler"),
+	)
+
+	first := &Message{ID: "1", Attributes: map[string]string{publisher.IdempotencyKey: "abc"}}
+	// A message republished by the publisher gets a new ID, but keeps the idempotency key.
+	republished := &Message{ID: "2", Attributes: map[string]string{publisher.IdempotencyKey: "abc"}}
+
+	if err := handler(context.Background(), first); err == nil {
+		t.Fatal("expected error")
+	}
+
+	fail = false
+	if err := handler(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler(context.Background(), republished); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
+
+func TestWithDeduplication_Replay(t *testing.T) {
+	calls := 0
+	handler := Chain(
+		func(ctx context.Context, msg *Message) error {
+			calls++
+			return nil
+		},
+		WithDeduplication(NewMemorySeenStore(10), "test.Handler"),
+	)
+
+	forOther := &Message{ID: "1", Attributes: map[string]string{ReplayHandlerKey: "other.Handler"}}
+	forThis := &Message{ID: "2", Attributes: map[string]string{ReplayHandlerKey: "test.Handler"}}
+
+	if err := handler(context.Background(), forOther); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("handler called %d times for a message replayed to another handler, want 0", calls)
+	}
+
+	if err := handler(context.Background(), forThis); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times for a message replayed to it, want 1", calls)
+	}
+}
+
+func TestReplayAttributes(t *testing.T) {
+	original := map[string]string{publisher.IdempotencyKey: "1", publisher.UserIDKey: "2"}
+
+	attributes, err := ReplayAttributes(original, "test.Handler", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes[ReplayHandlerKey] != "test.Handler" || attributes[publisher.UserIDKey] != "2" {
+		t.Errorf("unexpected replay attributes %v", attributes)
+	}
+	if attributes[publisher.IdempotencyKey] == "1" {
+		t.Error("expected a new idempotency key")
+	}
+	if _, ok := original[ReplayHandlerKey]; ok {
+		t.Error("expected the original attributes to stay unchanged")
+	}
+
+	attributes, err = ReplayAttributes(original, "test.Handler", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes[publisher.IdempotencyKey] != "1" {
+		t.Errorf("expected the idempotency key to be kept, got %v", attributes[publisher.IdempotencyKey])
+	}
+}
+
+func TestMemorySeenStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySeenStore(2)
+
+	store.MarkSeen(ctx, "a")
+	store.MarkSeen(ctx, "b")
+	store.MarkSeen(ctx, "a")
+	store.MarkSeen(ctx, "c")
+
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "d": false} {
+		seen, err := store.IsSeen(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen != want {
+			t.Errorf("IsSeen(%v) = %v, want %v", key, seen, want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package subscriber
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+// FlowControlConfig is the flow control of a single subscription, meant to be embedded in service configs.
+type FlowControlConfig struct {
+	MaxOutstandingMessages int           `default:"100" split_words:"true"`
+	MaxExtension           time.Duration `default:"10m" split_words:"true"`
+	// MaxConcurrentHandlers is enforced by the WithMaxConcurrency middleware, 0 means no limit.
+	MaxConcurrentHandlers int `default:"10" split_words:"true"`
+}
+
+// ReceiveSettings returns the part of the config enforced by the transport.
+func (c FlowControlConfig) ReceiveSettings() transport.ReceiveSettings {
+	return transport.ReceiveSettings{
+		MaxOutstandingMessages: c.MaxOutstandingMessages,
+		MaxExtension:           c.MaxExtension,
+	}
+}
+
+// WithMaxConcurrency limits the number of messages handled concurrently, 0 means no limit.
+func WithMaxConcurrency(limit int) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		if limit <= 0 {
+			return next
+		}
+		semaphore := make(chan struct{}, limit)
+
+		return func(ctx context.Context, msg *Message) error {
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return errors.Wrap(ctx.Err(), "couldn't wait for a free handler")
+			case <-ShuttingDown(ctx):
+				return errors.New("shutting down before a handler got free")
+			}
+			defer func() {
+				<-semaphore
+			}()
+
+			return next(ctx, msg)
+		}
+	}
+}
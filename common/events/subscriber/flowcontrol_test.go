@@ -0,0 +1,49 @@
+package subscriber
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithMaxConcurrency(t *testing.T) {
+	mutex := sync.Mutex{}
+	inFlight := 0
+	maxInFlight := 0
+
+	handler := Chain(
+		func(ctx context.Context, msg *Message) error {
+			mutex.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mutex.Unlock()
+
+			time.Sleep(time.Millisecond * 5)
+
+			mutex.Lock()
+			inFlight--
+			mutex.Unlock()
+			return nil
+		},
+		WithMaxConcurrency(2),
+	)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := handler(context.Background(), &Message{}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 2 {
+		t.Errorf("%d messages handled concurrently, want 2", maxInFlight)
+	}
+}
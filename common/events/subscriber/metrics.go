@@ -0,0 +1,59 @@
+package subscriber
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+)
+
+var (
+	handledEvents = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_handled_total",
+			Help: "Number of events handled, by topic, handler and outcome: ack, nack or permanent.",
+		},
+		[]string{"topic", "handler", "outcome"},
+	)
+	handleDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "events_handle_duration_seconds",
+			Help:    "Time it took to handle events, by topic and handler.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"topic", "handler"},
+	)
+)
+
+func WithMetrics(handlerName string) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			topic, ok := msg.Attributes[publisher.TopicKey]
+			if !ok {
+				topic = "unknown"
+			}
+
+			start := time.Now()
+			err := next(ctx, msg)
+
+			handleDuration.WithLabelValues(topic, handlerName).Observe(time.Since(start).Seconds())
+			handledEvents.WithLabelValues(topic, handlerName, handleOutcome(err)).Inc()
+
+			return err
+		}
+	}
+}
+
+// handleOutcome returns what happens to a message after handling it returned err: ack, nack or permanent.
+func handleOutcome(err error) string {
+	if err == nil {
+		return "ack"
+	}
+	if IsNonRetryableError(err) {
+		return "permanent"
+	}
+	return "nack"
+}
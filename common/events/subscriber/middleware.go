@@ -6,6 +6,8 @@ import (
 
 	"github.com/cube2222/grpc-utils/logger"
 	"github.com/cube2222/grpc-utils/requestid"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
 )
 
 func WithLogger(log logger.Logger) func(next HandlerFunc) HandlerFunc {
@@ -16,6 +18,25 @@ func WithLogger(log logger.Logger) func(next HandlerFunc) HandlerFunc {
 	}
 }
 
+// WithLogFields adds the topic, the message ID and the given attributes to the context logger.
+func WithLogFields(keys ...string) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			fields := []logger.Field{
+				logger.NewField(publisher.TopicKey, msg.Attributes[publisher.TopicKey]),
+				logger.NewField("message_id", msg.ID),
+			}
+			for _, key := range keys {
+				if value, ok := msg.Attributes[key]; ok {
+					fields = append(fields, logger.NewField(key, value))
+				}
+			}
+
+			return next(logger.Inject(ctx, logger.FromContext(ctx).With(fields...)), msg)
+		}
+	}
+}
+
 func WithLogging(keys ...string) func(next HandlerFunc) HandlerFunc {
 	return func(next HandlerFunc) HandlerFunc {
 		return func(ctx context.Context, msg *Message) error {
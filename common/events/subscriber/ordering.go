@@ -0,0 +1,48 @@
+package subscriber
+
+import (
+	"sync"
+)
+
+// keyLocks keeps messages of a subscription with the same ordering key from being handled concurrently, it doesn't order them.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu sync.Mutex
+	// waiters is the number of handlers holding or waiting for the lock.
+	waiters int
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{
+		locks: make(map[string]*keyLock),
+	}
+}
+
+// Lock blocks until no other message with this key is being handled and returns the function releasing the key.
+func (l *keyLocks) Lock(key string) func() {
+	l.mu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &keyLock{}
+		l.locks[key] = lock
+	}
+	lock.waiters++
+	l.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		l.mu.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,123 @@
+package subscriber
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+// concurrentTransport delivers all of its messages concurrently.
+type concurrentTransport struct {
+	messages []*transport.Message
+}
+
+func (t *concurrentTransport) Receive(ctx context.Context, subscription string, settings transport.ReceiveSettings, f transport.ReceiveFunc) error {
+	wg := sync.WaitGroup{}
+	for _, msg := range t.messages {
+		wg.Add(1)
+		go func(msg *transport.Message) {
+			defer wg.Done()
+			f(ctx, msg)
+		}(msg)
+	}
+	wg.Wait()
+	return nil
+}
+
+func TestSubscriptionClient_SerializesOrderingKey(t *testing.T) {
+	noop := func() {}
+	tr := &concurrentTransport{}
+	for _, key := range []string{"1", "1", "1", "2", "2", "2"} {
+		tr.messages = append(tr.messages, transport.NewMessage(
+			"id", nil, map[string]string{transport.OrderingKey: key}, 1, noop, noop,
+		))
+	}
+
+	mutex := sync.Mutex{}
+	inFlight := map[string]int{}
+	maxInFlight := 0
+
+	err := NewSubscriptionClient(tr).Subscribe(context.Background(), "sub", func(ctx context.Context, msg *Message) error {
+		key := msg.Attributes[transport.OrderingKey]
+
+		mutex.Lock()
+		inFlight[key]++
+		if inFlight[key] > maxInFlight {
+			maxInFlight = inFlight[key]
+		}
+		mutex.Unlock()
+
+		time.Sleep(time.Millisecond * 5)
+
+		mutex.Lock()
+		inFlight[key]--
+		mutex.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if maxInFlight != 1 {
+		t.Errorf("%d messages with the same ordering key handled concurrently, want 1", maxInFlight)
+	}
+}
+
+// transportFunc delivers the messages by calling the function.
+type transportFunc func(ctx context.Context, f transport.ReceiveFunc) error
+
+func (t transportFunc) Receive(ctx context.Context, subscription string, settings transport.ReceiveSettings, f transport.ReceiveFunc) error {
+	return t(ctx, f)
+}
+
+func TestSubscriptionClient_BackoffReleasesOrderingKey(t *testing.T) {
+	noop := func() {}
+	attributes := map[string]string{transport.OrderingKey: "1"}
+	failed := make(chan struct{})
+	nacked := make(chan struct{})
+	failing := transport.NewMessage("failing", nil, attributes, 1, noop, func() { close(nacked) })
+	next := transport.NewMessage("next", nil, attributes, 1, noop, noop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tr := transportFunc(func(ctx context.Context, f transport.ReceiveFunc) error {
+		go f(ctx, failing)
+		<-failed
+
+		handled := make(chan struct{})
+		go func() {
+			f(ctx, next)
+			close(handled)
+		}()
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Error("the ordering key is held during the backoff")
+		}
+
+		cancel()
+		select {
+		case <-nacked:
+		case <-time.After(time.Second):
+			t.Error("the backoff didn't stop on shutdown")
+		}
+		return nil
+	})
+
+	config := RetryConfig{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	handler := Chain(func(ctx context.Context, msg *Message) error {
+		if msg.ID == "failing" {
+			defer close(failed)
+			return errors.New("usos is down")
+		}
+		return nil
+	}, WithRetry(config))
+
+	if err := NewSubscriptionClient(tr).Subscribe(ctx, "sub", handler); err != nil {
+		t.Fatal(err)
+	}
+}
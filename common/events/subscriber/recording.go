@@ -0,0 +1,60 @@
+package subscriber
+
+import (
+	"context"
+	"time"
+
+	"github.com/cube2222/grpc-utils/logger"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+)
+
+// RecordedMessage is a message handled by a handler, as recorded by WithRecording.
+type RecordedMessage struct {
+	Time       time.Time         `json:"time"`
+	Handler    string            `json:"handler"`
+	Topic      string            `json:"topic"`
+	MessageID  string            `json:"message_id"`
+	Attributes map[string]string `json:"attributes"`
+	Data       []byte            `json:"data"`
+	// Outcome is ack, nack or permanent.
+	Outcome  string        `json:"outcome"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Recorder saves handled messages, so they can be inspected and replayed later.
+type Recorder interface {
+	Record(ctx context.Context, msg *RecordedMessage) error
+}
+
+// WithRecording records every message handled by the handler, together with the outcome.
+func WithRecording(recorder Recorder, handlerName string) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			recorded := &RecordedMessage{
+				Time:       start,
+				Handler:    handlerName,
+				Topic:      msg.Attributes[publisher.TopicKey],
+				MessageID:  msg.ID,
+				Attributes: msg.Attributes,
+				Data:       msg.Data,
+				Outcome:    handleOutcome(err),
+				Duration:   time.Since(start),
+			}
+			if err != nil {
+				recorded.Error = err.Error()
+			}
+
+			recordErr := recorder.Record(ctx, recorded)
+			if recordErr != nil {
+				logger.FromContext(ctx).Errorf("Couldn't record message %v: %v", msg.ID, recordErr)
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package subscriber
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type attemptKeyType struct{}
+
+var attemptKey = attemptKeyType{}
+
+// Attempt returns the delivery attempt of the message being handled, or 0 without WithRetry.
+func Attempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey).(int)
+	return attempt
+}
+
+// attemptTTL is how long attempts of a message are remembered since its last delivery,
+// it may never come back if it's redelivered to another instance.
+const attemptTTL = time.Hour
+
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// WithRetry backs off before nacking and gives up after MaxAttempts, which only survives restarts on Pub/Sub subscriptions with a dead letter policy.
+// The subscription backs off once the message's ordering key is released, so it doesn't hold up the later messages of the key.
+func WithRetry(config RetryConfig) HandlerMiddleware {
+	tracker := newAttemptTracker(attemptTTL)
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *Message) error {
+			if msg.DeliveryAttempt == 0 {
+				msg.DeliveryAttempt = tracker.next(msg.ID)
+			}
+			attempt := msg.DeliveryAttempt
+
+			err := next(context.WithValue(ctx, attemptKey, attempt), msg)
+			if err == nil || IsNonRetryableError(err) {
+				tracker.forget(msg.ID)
+				return err
+			}
+
+			if attempt >= config.MaxAttempts {
+				tracker.forget(msg.ID)
+				return NewNonRetryableError(errors.Wrapf(err, "giving up after %d attempts", attempt))
+			}
+
+			return &retryLaterError{
+				err:     err,
+				backoff: backoff(config, attempt),
+			}
+		}
+	}
+}
+
+// retryLaterError asks the subscription to back off before nacking the message.
+type retryLaterError struct {
+	err     error
+	backoff time.Duration
+}
+
+func (err *retryLaterError) Error() string {
+	return err.err.Error()
+}
+
+func (err *retryLaterError) Cause() error {
+	return err.err
+}
+
+// retryBackoff returns how long to wait before nacking the message which failed with err.
+func retryBackoff(err error) time.Duration {
+	for err != nil {
+		if retry, ok := err.(*retryLaterError); ok {
+			return retry.backoff
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return 0
+		}
+		err = cause.Cause()
+	}
+	return 0
+}
+
+// backoff returns a random duration between half and the whole of the exponential backoff for this attempt.
+func backoff(config RetryConfig, attempt int) time.Duration {
+	out := config.InitialBackoff
+	for i := 1; i < attempt && out < config.MaxBackoff; i++ {
+		out *= 2
+	}
+	if out > config.MaxBackoff {
+		out = config.MaxBackoff
+	}
+	if out <= 0 {
+		return 0
+	}
+
+	return out/2 + time.Duration(rand.Int63n(int64(out/2)+1))
+}
+
+type trackedAttempts struct {
+	attempts int
+	lastSeen time.Time
+}
+
+// attemptTracker counts the attempts of messages without a delivery attempt from the transport,
+// messages not seen for ttl are forgotten.
+type attemptTracker struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mutex     sync.Mutex
+	attempts  map[string]trackedAttempts
+	lastSweep time.Time
+}
+
+func newAttemptTracker(ttl time.Duration) *attemptTracker {
+	return &attemptTracker{
+		ttl:       ttl,
+		now:       time.Now,
+		attempts:  make(map[string]trackedAttempts),
+		lastSweep: time.Now(),
+	}
+}
+
+func (t *attemptTracker) next(id string) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	if now.Sub(t.lastSweep) > t.ttl {
+		for id, tracked := range t.attempts {
+			if now.Sub(tracked.lastSeen) > t.ttl {
+				delete(t.attempts, id)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	tracked := t.attempts[id]
+	if now.Sub(tracked.lastSeen) > t.ttl {
+		tracked.attempts = 0
+	}
+	tracked.attempts++
+	tracked.lastSeen = now
+	t.attempts[id] = tracked
+
+	return tracked.attempts
+}
+
+func (t *attemptTracker) forget(id string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.attempts, id)
+}
@@ -0,0 +1,119 @@
+package subscriber
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestWithRetry(t *testing.T) {
+	config := RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond * 4,
+	}
+
+	var attempts []int
+	handler := Chain(
+		func(ctx context.Context, msg *Message) error {
+			attempts = append(attempts, Attempt(ctx))
+			return errors.New("usos is down")
+		},
+		WithRetry(config),
+	)
+
+	for i := 1; i <= 3; i++ {
+		err := handler(context.Background(), &Message{ID: "1"})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if IsNonRetryableError(err) != (i == 3) {
+			t.Errorf("attempt %d: non retryable = %v, want %v", i, IsNonRetryableError(err), i == 3)
+		}
+	}
+
+	want := []int{1, 2, 3}
+	for i := range want {
+		if attempts[i] != want[i] {
+			t.Errorf("attempts = %v, want %v", attempts, want)
+			break
+		}
+	}
+
+	// The message has been given up on, so a new delivery starts counting from the beginning.
+	handler(context.Background(), &Message{ID: "1"})
+	if attempts[3] != 1 {
+		t.Errorf("attempt after giving up = %v, want 1", attempts[3])
+	}
+}
+
+func TestWithRetry_Backoff(t *testing.T) {
+	config := RetryConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+	}
+	handler := Chain(
+		func(ctx context.Context, msg *Message) error {
+			return errors.New("usos is down")
+		},
+		WithRetry(config),
+	)
+
+	err := handler(context.Background(), &Message{ID: "1"})
+	if err == nil || IsNonRetryableError(err) {
+		t.Errorf("expected retryable error, got %v", err)
+	}
+	// The backoff is left to the subscription, after wrapping by the outer middleware too.
+	if backoff := retryBackoff(errors.Wrap(err, "couldn't handle")); backoff < time.Minute*30 {
+		t.Errorf("expected the backoff of the first attempt, got %v", backoff)
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	config := RetryConfig{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Second * 10,
+	}
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: time.Millisecond * 500, max: time.Second},
+		{attempt: 2, min: time.Second, max: time.Second * 2},
+		{attempt: 3, min: time.Second * 2, max: time.Second * 4},
+		{attempt: 10, min: time.Second * 5, max: time.Second * 10},
+	}
+	for _, tt := range tests {
+		got := backoff(config, tt.attempt)
+		if got < tt.min || got > tt.max {
+			t.Errorf("backoff(%d) = %v, want between %v and %v", tt.attempt, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestAttemptTracker_TTL(t *testing.T) {
+	now := time.Now()
+	tracker := newAttemptTracker(time.Minute)
+	tracker.now = func() time.Time { return now }
+
+	tracker.next("redelivered elsewhere")
+	if attempt := tracker.next("1"); attempt != 1 {
+		t.Errorf("expected attempt 1, got %d", attempt)
+	}
+	now = now.Add(time.Second * 30)
+	if attempt := tracker.next("1"); attempt != 2 {
+		t.Errorf("expected attempt 2, got %d", attempt)
+	}
+
+	now = now.Add(time.Minute * 2)
+	if attempt := tracker.next("1"); attempt != 1 {
+		t.Errorf("expected the attempts to be forgotten, got attempt %d", attempt)
+	}
+	if _, ok := tracker.attempts["redelivered elsewhere"]; ok {
+		t.Error("expected the message not seen since to be forgotten")
+	}
+}
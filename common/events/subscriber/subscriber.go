@@ -2,16 +2,18 @@ package subscriber
 
 import (
 	"context"
+	"time"
 
 	"github.com/cube2222/grpc-utils/logger"
 
-	"cloud.google.com/go/pubsub"
+	"github.com/cube2222/usos-notifier/common/events/transport"
 )
 
 type Message struct {
-	ID         string
-	Data       []byte
-	Attributes map[string]string
+	ID              string
+	Data            []byte
+	Attributes      map[string]string
+	DeliveryAttempt int
 }
 
 type HandlerFunc func(context.Context, *Message) error
@@ -25,29 +27,73 @@ func Chain(f HandlerFunc, middleware ...HandlerMiddleware) HandlerFunc {
 	return handler
 }
 
-func NewSubscriptionClient(client *pubsub.Client) *SubscriptionClient {
+type shutdownKeyType struct{}
+
+var shutdownKey = shutdownKeyType{}
+
+// ShuttingDown returns a channel closed once the subscription is stopping, as the handlers' context isn't canceled.
+func ShuttingDown(ctx context.Context) <-chan struct{} {
+	shutdown, _ := ctx.Value(shutdownKey).(<-chan struct{})
+	return shutdown
+}
+
+func withShutdown(ctx context.Context, shutdown <-chan struct{}) context.Context {
+	return context.WithValue(ctx, shutdownKey, shutdown)
+}
+
+func NewSubscriptionClient(transport transport.Subscriber) *SubscriptionClient {
 	return &SubscriptionClient{
-		cli: client,
+		transport: transport,
 	}
 }
 
 type SubscriptionClient struct {
-	cli *pubsub.Client
+	transport transport.Subscriber
+	settings  transport.ReceiveSettings
+}
+
+// WithReceiveSettings sets the flow control of the subscription, the transport defaults are used otherwise.
+func (cli *SubscriptionClient) WithReceiveSettings(settings transport.ReceiveSettings) *SubscriptionClient {
+	cli.settings = settings
+	return cli
 }
 
+// Subscribe handles messages from the subscription, which has to have message ordering enabled, until ctx is done.
 func (cli *SubscriptionClient) Subscribe(ctx context.Context, eventType string, handler HandlerFunc) error {
-	return cli.cli.Subscription(eventType).Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+	settings := cli.settings
+	settings.RequireOrdering = true
+
+	// Messages of other subscriptions don't share the ordering keys.
+	locks := newKeyLocks()
+	shutdown := ctx.Done()
+	return cli.transport.Receive(ctx, eventType, settings, func(ctx context.Context, msg *transport.Message) {
+		ctx = withShutdown(context.WithoutCancel(ctx), shutdown)
+
+		unlock := func() {}
+		if key := msg.Attributes[transport.OrderingKey]; key != "" {
+			unlock = locks.Lock(key)
+		}
+
 		err := handler(ctx, &Message{
-			ID:         msg.ID,
-			Data:       msg.Data,
-			Attributes: msg.Attributes,
+			ID:              msg.ID,
+			Data:            msg.Data,
+			Attributes:      msg.Attributes,
+			DeliveryAttempt: msg.DeliveryAttempt,
 		})
+		unlock()
 		if err != nil {
 			if IsNonRetryableError(err) {
-				msg.Ack()
 				logger.FromContext(ctx).Errorf("Permanent error: %v", err)
+				msg.Ack()
+				return
+			}
+			// Pub/Sub redelivers the later messages of the ordering key after the nacked one.
+			select {
+			case <-time.After(retryBackoff(err)):
+			case <-shutdown:
 			}
 			msg.Nack()
+			return
 		}
 		msg.Ack()
 	})
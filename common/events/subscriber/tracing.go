@@ -0,0 +1,33 @@
+package subscriber
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cube2222/usos-notifier/common/tracing"
+)
+
+// WithTracing starts a consumer span for each handled message, continuing the trace propagated in its attributes.
+func WithTracing(handlerName string) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, msg *Message) (err error) {
+			ctx = tracing.Extract(ctx, msg.Attributes)
+			ctx, span := tracing.StartSpan(
+				ctx,
+				handlerName,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					attribute.String("messaging.message_id", msg.ID),
+					attribute.Int("messaging.delivery_attempt", msg.DeliveryAttempt),
+				),
+			)
+			defer func() {
+				tracing.End(span, err)
+			}()
+
+			return next(ctx, msg)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package subscriber
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/tracing"
+)
+
+func TestWithTracing(t *testing.T) {
+	_, err := tracing.Init("test", tracing.ExporterNone, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	var published map[string]string
+	publish := publisher.WithTracing(func(ctx context.Context, eventType string, metadata map[string]string, message string) error {
+		published = metadata
+		return nil
+	})
+
+	ctx, span := tracing.StartSpan(context.Background(), "test")
+	defer span.End()
+	if err := publish(ctx, "notifications", map[string]string{}, "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	var handled trace.SpanContext
+	handler := Chain(
+		func(ctx context.Context, msg *Message) error {
+			handled = trace.SpanContextFromContext(ctx)
+			return nil
+		},
+		WithTracing("test.Handler"),
+	)
+	if err := handler(context.Background(), &Message{ID: "1", Attributes: published}); err != nil {
+		t.Fatal(err)
+	}
+
+	if handled.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("handler trace id = %v, want %v", handled.TraceID(), span.SpanContext().TraceID())
+	}
+	if handled.SpanID() == span.SpanContext().SpanID() {
+		t.Errorf("handler should run in its own span")
+	}
+}
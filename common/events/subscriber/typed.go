@@ -0,0 +1,34 @@
+package subscriber
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events"
+)
+
+// TypedHandlerFunc handles a decoded event, a pointer of the type returned by its schema's New function.
+type TypedHandlerFunc func(ctx context.Context, msg *Message, event interface{}) error
+
+// Typed decodes messages as events of the given name, messages which can't be decoded fail permanently.
+func Typed(registry *events.Registry, eventName string, handler TypedHandlerFunc) HandlerFunc {
+	return func(ctx context.Context, msg *Message) error {
+		data, err := DecodeTextMessage(msg)
+		if err != nil {
+			return NewNonRetryableError(errors.Wrap(err, "couldn't decode text message"))
+		}
+
+		event, err := registry.Decode(eventName, data, msg.Attributes)
+		if err != nil {
+			return NewNonRetryableError(errors.Wrap(err, "couldn't decode event"))
+		}
+
+		return handler(ctx, msg, event)
+	}
+}
+
+// SubscribeTyped subscribes the handler to events of the given name registered in the default registry.
+func (cli *SubscriptionClient) SubscribeTyped(ctx context.Context, subscription, eventName string, handler TypedHandlerFunc, middleware ...HandlerMiddleware) error {
+	return cli.Subscribe(ctx, subscription, Chain(Typed(events.DefaultRegistry, eventName, handler), middleware...))
+}
@@ -1,16 +1,17 @@
 package subscriber
 
 import (
-	"encoding/base64"
 	"encoding/json"
 
 	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events"
 )
 
 func DecodeJSONMessage(message *Message, dst interface{}) error {
 	data, err := DecodeTextMessage(message)
 	if err != nil {
-		return errors.Wrap(err, "couldn't base64 decode message")
+		return errors.Wrap(err, "couldn't decode text message")
 	}
 
 	err = json.Unmarshal(data, dst)
@@ -21,6 +22,7 @@ func DecodeJSONMessage(message *Message, dst interface{}) error {
 	return nil
 }
 
+// DecodeTextMessage decodes the message payload according to its content encoding, see events.DecodePayload.
 func DecodeTextMessage(message *Message) ([]byte, error) {
-	return base64.StdEncoding.DecodeString(string(message.Data))
+	return events.DecodePayload(message.Data, message.Attributes)
 }
@@ -0,0 +1,163 @@
+package cloudpubsub
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+// BatchSettings control how published messages are batched, zero values mean the Pub/Sub client defaults.
+type BatchSettings struct {
+	CountThreshold int
+	ByteThreshold  int
+	DelayThreshold time.Duration
+}
+
+var ErrTopicNotDeclared = errors.New("topic not declared")
+var ErrStopped = errors.New("transport stopped")
+
+// Transport is the Google Cloud Pub/Sub backed transport, topics have to be declared before publishing.
+type Transport struct {
+	cli   *pubsub.Client
+	batch BatchSettings
+
+	mu      sync.RWMutex
+	topics  map[string]*pubsub.Topic
+	stopped bool
+}
+
+func NewTransport(cli *pubsub.Client) *Transport {
+	return &Transport{
+		cli:    cli,
+		topics: make(map[string]*pubsub.Topic),
+	}
+}
+
+// WithBatching sets the batching of published messages, it has to be called before declaring topics.
+func (t *Transport) WithBatching(settings BatchSettings) *Transport {
+	t.batch = settings
+	return t
+}
+
+// Declare checks that the topics exist and prepares them for publishing.
+func (t *Transport) Declare(ctx context.Context, topics ...string) error {
+	for _, topic := range topics {
+		t.mu.RLock()
+		_, ok := t.topics[topic]
+		t.mu.RUnlock()
+		if ok {
+			continue
+		}
+
+		tp := t.cli.Topic(topic)
+		exists, err := tp.Exists(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't check if topic %v exists", topic)
+		}
+		if !exists {
+			return errors.Errorf("topic %v doesn't exist", topic)
+		}
+
+		tp.EnableMessageOrdering = true
+		if t.batch.CountThreshold != 0 {
+			tp.PublishSettings.CountThreshold = t.batch.CountThreshold
+		}
+		if t.batch.ByteThreshold != 0 {
+			tp.PublishSettings.ByteThreshold = t.batch.ByteThreshold
+		}
+		if t.batch.DelayThreshold != 0 {
+			tp.PublishSettings.DelayThreshold = t.batch.DelayThreshold
+		}
+
+		t.mu.Lock()
+		if t.stopped {
+			t.mu.Unlock()
+			tp.Stop()
+			return ErrStopped
+		}
+		if _, ok := t.topics[topic]; ok {
+			// Declared concurrently in the meantime.
+			tp.Stop()
+		} else {
+			t.topics[topic] = tp
+		}
+		t.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (t *Transport) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) (string, error) {
+	t.mu.RLock()
+	tp, ok := t.topics[topic]
+	stopped := t.stopped
+	t.mu.RUnlock()
+	if stopped {
+		return "", ErrStopped
+	}
+	if !ok {
+		return "", errors.Wrapf(ErrTopicNotDeclared, "couldn't publish to %v", topic)
+	}
+
+	orderingKey := attributes[transport.OrderingKey]
+
+	res := tp.Publish(ctx, &pubsub.Message{
+		Data:        data,
+		Attributes:  attributes,
+		OrderingKey: orderingKey,
+	})
+
+	id, err := res.Get(ctx)
+	if err != nil && orderingKey != "" {
+		// Pub/Sub pauses the ordering key after a failure, the caller retries, so we resume right away.
+		tp.ResumePublish(orderingKey)
+	}
+
+	return id, err
+}
+
+// Stop sends all pending messages and stops publishing.
+func (t *Transport) Stop() {
+	t.mu.Lock()
+	t.stopped = true
+	topics := t.topics
+	t.mu.Unlock()
+
+	for _, tp := range topics {
+		tp.Stop()
+	}
+}
+
+func (t *Transport) Receive(ctx context.Context, subscription string, settings transport.ReceiveSettings, f transport.ReceiveFunc) error {
+	sub := t.cli.Subscription(subscription)
+	if settings.MaxOutstandingMessages != 0 {
+		sub.ReceiveSettings.MaxOutstandingMessages = settings.MaxOutstandingMessages
+	}
+	if settings.MaxExtension != 0 {
+		sub.ReceiveSettings.MaxExtension = settings.MaxExtension
+	}
+	if settings.RequireOrdering {
+		config, err := sub.Config(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't get config of subscription %v", subscription)
+		}
+		if !config.EnableMessageOrdering {
+			return errors.Errorf("subscription %v doesn't have message ordering enabled", subscription)
+		}
+	}
+
+	return sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		// The delivery attempt is only tracked by Pub/Sub for subscriptions with a dead letter policy.
+		deliveryAttempt := 0
+		if msg.DeliveryAttempt != nil {
+			deliveryAttempt = *msg.DeliveryAttempt
+		}
+
+		f(ctx, transport.NewMessage(msg.ID, msg.Data, msg.Attributes, deliveryAttempt, msg.Ack, msg.Nack))
+	})
+}
@@ -0,0 +1,142 @@
+package cloudpubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/pkg/errors"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+func newTestTransport(t *testing.T, topics ...string) (*Transport, *pstest.Server) {
+	ctx := context.Background()
+	srv := pstest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := grpc.NewClient(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli, err := pubsub.NewClient(ctx, "project", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+
+	for _, topic := range topics {
+		if _, err := cli.CreateTopic(ctx, topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewTransport(cli).WithBatching(BatchSettings{DelayThreshold: time.Millisecond}), srv
+}
+
+func TestTransport_ConcurrentPublish(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	tr, srv := newTestTransport(t, "first", "second")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			topic := "first"
+			if i%2 == 1 {
+				topic = "second"
+			}
+			// Declaring concurrently with publishing to the same topic is allowed.
+			if err := tr.Declare(ctx, topic); err != nil {
+				t.Error(err)
+				return
+			}
+			_, err := tr.Publish(ctx, topic, []byte(fmt.Sprint(i)), map[string]string{"key": fmt.Sprint(i % 5)})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	tr.Stop()
+
+	if n := len(srv.Messages()); n != 50 {
+		t.Errorf("expected 50 published messages, got %d", n)
+	}
+}
+
+func TestTransport_Declare(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	tr, _ := newTestTransport(t, "events")
+	defer tr.Stop()
+
+	if _, err := tr.Publish(ctx, "events", []byte("hello"), nil); errors.Cause(err) != ErrTopicNotDeclared {
+		t.Errorf("expected ErrTopicNotDeclared, got %v", err)
+	}
+	if err := tr.Declare(ctx, "events", "missing"); err == nil {
+		t.Error("expected error when declaring a topic which doesn't exist")
+	}
+	if _, err := tr.Publish(ctx, "events", []byte("hello"), nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransport_PublishAfterStop(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	tr, _ := newTestTransport(t, "events")
+	if err := tr.Declare(ctx, "events"); err != nil {
+		t.Fatal(err)
+	}
+	tr.Stop()
+
+	if _, err := tr.Publish(ctx, "events", []byte("hello"), nil); err != ErrStopped {
+		t.Errorf("expected ErrStopped, got %v", err)
+	}
+	if err := tr.Declare(ctx, "events"); err != nil {
+		// Already declared topics are a no-op.
+		t.Error(err)
+	}
+}
+
+func TestTransport_ReceiveRequiresOrdering(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	tr, _ := newTestTransport(t, "topic")
+	for name, ordered := range map[string]bool{"unordered": false, "ordered": true} {
+		_, err := tr.cli.CreateSubscription(ctx, name, pubsub.SubscriptionConfig{
+			Topic:                 tr.cli.Topic("topic"),
+			EnableMessageOrdering: ordered,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := transport.ReceiveSettings{RequireOrdering: true}
+
+	err := tr.Receive(ctx, "unordered", settings, func(ctx context.Context, msg *transport.Message) {})
+	if err == nil {
+		t.Error("expected error receiving from a subscription without message ordering")
+	}
+
+	receiveCtx, stop := context.WithTimeout(ctx, time.Millisecond*100)
+	defer stop()
+	err = tr.Receive(receiveCtx, "ordered", settings, func(ctx context.Context, msg *transport.Message) {})
+	if err != nil {
+		t.Error(err)
+	}
+}
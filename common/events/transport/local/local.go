@@ -0,0 +1,263 @@
+package local
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+var ErrTopicNotFound = errors.New("topic not found")
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// Broker is an in-process transport for tests, delivering messages with the same ordering key one at a time, in order.
+type Broker struct {
+	redeliveryDelay time.Duration
+
+	mu            sync.Mutex
+	topics        map[string][]*subscription
+	subscriptions map[string]*subscription
+	lastID        int64
+}
+
+func NewBroker(redeliveryDelay time.Duration) *Broker {
+	return &Broker{
+		redeliveryDelay: redeliveryDelay,
+		topics:          make(map[string][]*subscription),
+		subscriptions:   make(map[string]*subscription),
+	}
+}
+
+// CreateTopic declares a topic. Publishing to an undeclared topic fails, like it does on Pub/Sub.
+func (b *Broker) CreateTopic(topic string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.topics[topic]; !ok {
+		b.topics[topic] = nil
+	}
+}
+
+// CreateSubscription declares a subscription to the topic, which gets the messages published from now on.
+func (b *Broker) CreateSubscription(name, topic string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscriptions[name]; ok {
+		return
+	}
+
+	sub := &subscription{
+		ready:    make(chan struct{}, 1),
+		inFlight: make(map[string]bool),
+	}
+	b.subscriptions[name] = sub
+	b.topics[topic] = append(b.topics[topic], sub)
+}
+
+func (b *Broker) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) (string, error) {
+	b.mu.Lock()
+	subs, ok := b.topics[topic]
+	if !ok {
+		b.mu.Unlock()
+		return "", errors.Wrapf(ErrTopicNotFound, "couldn't publish to %v", topic)
+	}
+	b.lastID++
+	id := strconv.FormatInt(b.lastID, 10)
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.push(&delivery{
+			id:         id,
+			data:       data,
+			attributes: copyAttributes(attributes),
+		})
+	}
+
+	return id, nil
+}
+
+// Receive delivers messages until ctx is done and the handlers have finished, only MaxOutstandingMessages is supported.
+func (b *Broker) Receive(ctx context.Context, name string, settings transport.ReceiveSettings, f transport.ReceiveFunc) error {
+	b.mu.Lock()
+	sub, ok := b.subscriptions[name]
+	b.mu.Unlock()
+	if !ok {
+		return errors.Wrapf(ErrSubscriptionNotFound, "couldn't receive from %v", name)
+	}
+
+	var outstanding chan struct{}
+	if settings.MaxOutstandingMessages > 0 {
+		outstanding = make(chan struct{}, settings.MaxOutstandingMessages)
+	}
+	acquire := func() bool {
+		if outstanding == nil {
+			return true
+		}
+		select {
+		case outstanding <- struct{}{}:
+			return true
+		default:
+			return false
+		}
+	}
+	release := func() {
+		if outstanding == nil {
+			return
+		}
+		<-outstanding
+		// There may be messages waiting for this slot.
+		sub.signal()
+	}
+
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.ready:
+		}
+
+		for acquire() {
+			d, ok := sub.next()
+			if !ok {
+				// Nothing to deliver, give back the slot without waking up the loop again.
+				if outstanding != nil {
+					<-outstanding
+				}
+				break
+			}
+
+			wg.Add(1)
+			go func(d *delivery) {
+				defer wg.Done()
+				b.deliver(ctx, sub, d, release, f)
+			}(d)
+		}
+	}
+}
+
+// deliver hands the message to f, release is called once the message gets acked or nacked.
+func (b *Broker) deliver(ctx context.Context, sub *subscription, d *delivery, release func(), f transport.ReceiveFunc) {
+	// Only one delivery of a message is in flight at a time, so this isn't racy.
+	d.attempts++
+	attempt := d.attempts
+
+	once := sync.Once{}
+	ack := func() {
+		once.Do(func() {
+			sub.done(d)
+			release()
+		})
+	}
+	nack := func() {
+		once.Do(func() {
+			time.AfterFunc(b.redeliveryDelay, func() {
+				sub.redeliver(d)
+			})
+			release()
+		})
+	}
+
+	f(ctx, transport.NewMessage(d.id, d.data, copyAttributes(d.attributes), attempt, ack, nack))
+}
+
+type delivery struct {
+	id         string
+	data       []byte
+	attributes map[string]string
+	attempts   int
+}
+
+func (d *delivery) orderingKey() string {
+	return d.attributes[transport.OrderingKey]
+}
+
+type subscription struct {
+	mu    sync.Mutex
+	queue []*delivery
+	// inFlight holds the ordering keys of the messages currently being handled.
+	inFlight map[string]bool
+	// ready signals that the queue may contain a message which can be delivered.
+	ready chan struct{}
+}
+
+func (s *subscription) push(d *delivery) {
+	s.mu.Lock()
+	s.queue = append(s.queue, d)
+	s.mu.Unlock()
+
+	s.signal()
+}
+
+// next takes the first message from the queue, which doesn't have to wait for another message with the same ordering key.
+func (s *subscription) next() (*delivery, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, d := range s.queue {
+		key := d.orderingKey()
+		if key != "" {
+			if s.inFlight[key] {
+				continue
+			}
+			s.inFlight[key] = true
+		}
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+
+		return d, true
+	}
+
+	return nil, false
+}
+
+// done releases the ordering key of a handled message.
+func (s *subscription) done(d *delivery) {
+	key := d.orderingKey()
+	if key == "" {
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.inFlight, key)
+	s.mu.Unlock()
+
+	s.signal()
+}
+
+// redeliver queues a nacked message again, in front if it has an ordering key.
+func (s *subscription) redeliver(d *delivery) {
+	key := d.orderingKey()
+	if key == "" {
+		s.push(d)
+		return
+	}
+
+	s.mu.Lock()
+	s.queue = append([]*delivery{d}, s.queue...)
+	delete(s.inFlight, key)
+	s.mu.Unlock()
+
+	s.signal()
+}
+
+func (s *subscription) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func copyAttributes(attributes map[string]string) map[string]string {
+	out := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		out[k] = v
+	}
+	return out
+}
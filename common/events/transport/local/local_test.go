@@ -0,0 +1,207 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+func TestBroker_FanOut(t *testing.T) {
+	b := NewBroker(0)
+	b.CreateSubscription("first-events", "events")
+	b.CreateSubscription("second-events", "events")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	_, err := b.Publish(ctx, "events", []byte("hello"), map[string]string{"user_id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sub := range []string{"first-events", "second-events"} {
+		received := receiveN(ctx, t, b, sub, 1, func(msg *transport.Message) {
+			msg.Ack()
+		})
+		if string(received[0].Data) != "hello" || received[0].Attributes["user_id"] != "1" {
+			t.Errorf("%v received %+v", sub, received[0])
+		}
+	}
+}
+
+func TestBroker_NackRedelivers(t *testing.T) {
+	b := NewBroker(0)
+	b.CreateSubscription("sub", "events")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	id, err := b.Publish(ctx, "events", []byte("hello"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	received := receiveN(ctx, t, b, "sub", 3, func(msg *transport.Message) {
+		calls++
+		if calls < 3 {
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
+	for i, msg := range received {
+		if msg.ID != id {
+			t.Errorf("got message ID %v, want %v", msg.ID, id)
+		}
+		if msg.DeliveryAttempt != i+1 {
+			t.Errorf("got delivery attempt %v, want %v", msg.DeliveryAttempt, i+1)
+		}
+	}
+}
+
+func TestBroker_OrderingKey(t *testing.T) {
+	b := NewBroker(0)
+	b.CreateSubscription("sub", "events")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for _, data := range []string{"1", "2", "3", "4"} {
+		_, err := b.Publish(ctx, "events", []byte(data), map[string]string{transport.OrderingKey: "user"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	mutex := sync.Mutex{}
+	var handled []string
+	inFlight := 0
+	nacked := false
+
+	err := b.Receive(ctx, "sub", transport.ReceiveSettings{}, func(ctx context.Context, msg *transport.Message) {
+		mutex.Lock()
+		inFlight++
+		if inFlight > 1 {
+			t.Error("messages with the same ordering key handled concurrently")
+		}
+		mutex.Unlock()
+
+		time.Sleep(time.Millisecond * 5)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		inFlight--
+		handled = append(handled, string(msg.Data))
+		if string(msg.Data) == "2" && !nacked {
+			nacked = true
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+		if len(handled) == 5 {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(handled) != "[1 2 2 3 4]" {
+		t.Errorf("handled %v, want [1 2 2 3 4]", handled)
+	}
+}
+
+func TestBroker_MaxOutstandingMessages(t *testing.T) {
+	b := NewBroker(0)
+	b.CreateSubscription("sub", "events")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		_, err := b.Publish(ctx, "events", []byte("hello"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel = context.WithCancel(ctx)
+	defer cancel()
+
+	mutex := sync.Mutex{}
+	outstanding := 0
+	maxOutstanding := 0
+	handled := 0
+
+	err := b.Receive(ctx, "sub", transport.ReceiveSettings{MaxOutstandingMessages: 3}, func(ctx context.Context, msg *transport.Message) {
+		mutex.Lock()
+		outstanding++
+		if outstanding > maxOutstanding {
+			maxOutstanding = outstanding
+		}
+		mutex.Unlock()
+
+		time.Sleep(time.Millisecond * 5)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		outstanding--
+		handled++
+		msg.Ack()
+		if handled == 10 {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if maxOutstanding != 3 {
+		t.Errorf("%d messages outstanding at once, want 3", maxOutstanding)
+	}
+}
+
+func TestBroker_UnknownTopic(t *testing.T) {
+	b := NewBroker(0)
+
+	_, err := b.Publish(context.Background(), "events", []byte("hello"), nil)
+	if err == nil {
+		t.Error("expected error when publishing to an undeclared topic")
+	}
+}
+
+// receiveN receives from the subscription until n messages have been handled.
+func receiveN(ctx context.Context, t *testing.T, b *Broker, subscription string, n int, f func(msg *transport.Message)) []*transport.Message {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mutex := sync.Mutex{}
+	var received []*transport.Message
+
+	err := b.Receive(ctx, subscription, transport.ReceiveSettings{}, func(ctx context.Context, msg *transport.Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		received = append(received, msg)
+		f(msg)
+		if len(received) == n {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != n {
+		t.Fatalf("received %v messages, want %v", len(received), n)
+	}
+
+	return received
+}
@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"context"
+	"time"
+)
+
+// OrderingKey is the attribute holding the ordering key of a message.
+const OrderingKey = "ordering_key"
+
+// Message is a single event delivered by a transport, to be either acked or nacked.
+type Message struct {
+	ID         string
+	Data       []byte
+	Attributes map[string]string
+	// DeliveryAttempt counts deliveries including this one, 0 if the transport doesn't track it.
+	DeliveryAttempt int
+
+	ack  func()
+	nack func()
+}
+
+func NewMessage(id string, data []byte, attributes map[string]string, deliveryAttempt int, ack, nack func()) *Message {
+	return &Message{
+		ID:              id,
+		Data:            data,
+		Attributes:      attributes,
+		DeliveryAttempt: deliveryAttempt,
+		ack:             ack,
+		nack:            nack,
+	}
+}
+
+// Ack marks the message as handled, it won't be redelivered.
+func (msg *Message) Ack() {
+	msg.ack()
+}
+
+// Nack marks the message as failed, it will be redelivered.
+func (msg *Message) Nack() {
+	msg.nack()
+}
+
+type ReceiveFunc func(ctx context.Context, msg *Message)
+
+// Publisher sends messages to topics. It returns the ID of the published message.
+type Publisher interface {
+	Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) (string, error)
+}
+
+// ReceiveSettings control the flow of messages from a subscription, zero values mean the defaults.
+type ReceiveSettings struct {
+	// MaxOutstandingMessages is the maximum number of messages received, but not yet acked or nacked.
+	MaxOutstandingMessages int
+	// MaxExtension is the maximum time the ack deadline of a message being handled is extended for.
+	MaxExtension time.Duration
+	// RequireOrdering fails receiving from a subscription which doesn't deliver messages in ordering key order.
+	RequireOrdering bool
+}
+
+// Subscriber receives messages from a subscription until ctx is done, possibly concurrently.
+type Subscriber interface {
+	Receive(ctx context.Context, subscription string, settings ReceiveSettings, f ReceiveFunc) error
+}
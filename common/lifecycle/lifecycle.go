@@ -0,0 +1,182 @@
+package lifecycle
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// Lifecycle owns the root context of a service.
+// On SIGTERM or SIGINT, or when any of its goroutines fails, it cancels the context,
+// waits for the goroutines to finish and runs the shutdown hooks, all within the shutdown timeout.
+type Lifecycle struct {
+	ctx             context.Context
+	cancel          context.CancelFunc
+	shutdownTimeout time.Duration
+
+	wg     sync.WaitGroup
+	failed chan error
+
+	mutex sync.Mutex
+	hooks []hook
+}
+
+type hook struct {
+	name string
+	f    func(ctx context.Context) error
+}
+
+func New(shutdownTimeout time.Duration) *Lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Lifecycle{
+		ctx:             ctx,
+		cancel:          cancel,
+		shutdownTimeout: shutdownTimeout,
+		failed:          make(chan error, 1),
+	}
+}
+
+// Context returns the root context, which is canceled when shutting down.
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// Go runs f in a new goroutine. f should return once its context is canceled.
+// If it returns an error before that, the service shuts down.
+func (l *Lifecycle) Go(name string, f func(ctx context.Context) error) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		err := f(l.ctx)
+		if err != nil && l.ctx.Err() == nil {
+			select {
+			case l.failed <- errors.Wrap(err, name):
+			default:
+			}
+		}
+	}()
+}
+
+// OnShutdown registers f to be called on shutdown, after all the goroutines have finished.
+// Hooks are called in reverse order of registration.
+func (l *Lifecycle) OnShutdown(name string, f func(ctx context.Context) error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.hooks = append(l.hooks, hook{
+		name: name,
+		f:    f,
+	})
+}
+
+// ServeHTTP serves the server until shutdown, then waits for in-flight requests to finish.
+func (l *Lifecycle) ServeHTTP(name string, server *http.Server) {
+	l.Go(name, func(ctx context.Context) error {
+		errs := make(chan error, 1)
+		go func() {
+			errs <- server.ListenAndServe()
+		}()
+
+		select {
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), l.shutdownTimeout)
+		defer cancel()
+
+		return server.Shutdown(shutdownCtx)
+	})
+}
+
+// ServeGRPC serves the server until shutdown, then waits for in-flight calls to finish.
+// Calls still running after the shutdown timeout get canceled.
+func (l *Lifecycle) ServeGRPC(name string, server *grpc.Server, lis net.Listener) {
+	l.Go(name, func(ctx context.Context) error {
+		errs := make(chan error, 1)
+		go func() {
+			errs <- server.Serve(lis)
+		}()
+
+		select {
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+		}
+
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(l.shutdownTimeout):
+			server.Stop()
+		}
+
+		return nil
+	})
+}
+
+// Wait blocks until a shutdown signal is received or a goroutine fails, and then shuts down.
+// It returns the error of the failed goroutine, if any.
+func (l *Lifecycle) Wait() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	var err error
+	select {
+	case sig := <-signals:
+		log.Printf("Received %v, shutting down.", sig)
+	case err = <-l.failed:
+		log.Printf("Shutting down because of error: %v", err)
+	}
+
+	l.shutdown()
+
+	return err
+}
+
+func (l *Lifecycle) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), l.shutdownTimeout)
+	defer cancel()
+
+	l.cancel()
+
+	finished := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		log.Println("Timed out waiting for goroutines to finish.")
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for i := len(l.hooks) - 1; i >= 0; i-- {
+		err := l.hooks[i].f(ctx)
+		if err != nil {
+			log.Printf("Shutdown hook %v failed: %v", l.hooks[i].name, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLifecycle_ShutdownOnFailure(t *testing.T) {
+	lc := New(time.Second * 5)
+
+	var order []string
+	lc.OnShutdown("first", func(ctx context.Context) error {
+		order = append(order, "first")
+		return nil
+	})
+	lc.OnShutdown("second", func(ctx context.Context) error {
+		order = append(order, "second")
+		return nil
+	})
+
+	drained := false
+	lc.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		drained = true
+		return nil
+	})
+	lc.Go("failing", func(ctx context.Context) error {
+		return errors.New("couldn't listen")
+	})
+
+	err := lc.Wait()
+	if err == nil {
+		t.Fatal("expected the error of the failed goroutine")
+	}
+	if !drained {
+		t.Error("worker hasn't finished before shutdown hooks")
+	}
+	if len(order) != 2 || order[0] != "second" || order[1] != "first" {
+		t.Errorf("hooks called in order %v, want [second first]", order)
+	}
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPInterceptor(t *testing.T) {
+	m := chi.NewMux()
+	m.Use(HTTPInterceptor)
+	m.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other", nil))
+
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues("/users/{id}", http.MethodGet, "418")); n != 2 {
+		t.Errorf("expected 2 requests counted by route, got %v", n)
+	}
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues("unmatched", http.MethodGet, "404")); n != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", n)
+	}
+}
+
+func TestGRPCServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Get"}
+	_, err := GRPCServerInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected the handler's error, got %v", err)
+	}
+
+	if n := testutil.ToFloat64(grpcRequests.WithLabelValues(info.FullMethod, "NotFound")); n != 1 {
+		t.Errorf("expected 1 request counted, got %v", n)
+	}
+}
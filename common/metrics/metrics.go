@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// NewServer creates an http server exposing the Prometheus metrics on /metrics.
+func NewServer(port int) *http.Server {
+	m := http.NewServeMux()
+	m.Handle("/metrics", promhttp.Handler())
+
+	return &http.Server{
+		Addr:    fmt.Sprintf(":%v", port),
+		Handler: m,
+	}
+}
+
+// Outcome returns the outcome label for an operation which returned err.
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,203 @@
+package universities
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultID is the university of users who authorized before universities were supported.
+const DefaultID = "mimuw"
+
+// University describes how to log into the USOSweb of a university through its CAS.
+type University struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// CASLoginURL is the CAS login page.
+	CASLoginURL string `json:"cas_login_url"`
+	// USOSwebURL is the base URL of USOSweb, without a trailing slash.
+	USOSwebURL string `json:"usosweb_url"`
+	// USOSAPIURL is the base URL of the USOS API, empty if authorizing through it isn't supported.
+	USOSAPIURL string `json:"usosapi_url"`
+	// LoginTicketPattern finds the login ticket on the CAS login page.
+	LoginTicketPattern string `json:"login_ticket_pattern"`
+	// LoginQuery are added to the CAS login page URL, besides the service.
+	LoginQuery map[string]string `json:"login_query"`
+	// LoginForm are submitted with the CAS login form, besides the username, password and login ticket.
+	LoginForm map[string]string `json:"login_form"`
+	// InvalidPasswordPattern and AccountLockedPattern find the error messages on the CAS login page after a failed login.
+	InvalidPasswordPattern string `json:"invalid_password_pattern"`
+	AccountLockedPattern   string `json:"account_locked_pattern"`
+
+	loginTicket     *regexp.Regexp
+	invalidPassword *regexp.Regexp
+	accountLocked   *regexp.Regexp
+}
+
+// FindLoginTicket finds the login ticket on the CAS login page.
+func (u *University) FindLoginTicket(page []byte) []byte {
+	return u.loginTicket.Find(page)
+}
+
+// IsInvalidPassword reports whether the CAS login page says the username or password was invalid.
+func (u *University) IsInvalidPassword(page []byte) bool {
+	return u.invalidPassword != nil && u.invalidPassword.Match(page)
+}
+
+// IsAccountLocked reports whether the CAS login page says the account is locked.
+func (u *University) IsAccountLocked(page []byte) bool {
+	return u.accountLocked != nil && u.accountLocked.Match(page)
+}
+
+// ServiceURL is the USOSweb page CAS redirects to after logging in.
+func (u *University) ServiceURL() string {
+	return u.USOSwebURL + "/kontroler.php?_action=logowaniecas/index"
+}
+
+func (u *University) compile() error {
+	if u.ID == "" || u.CASLoginURL == "" || u.USOSwebURL == "" {
+		return errors.New("missing id, cas login url or usosweb url")
+	}
+	loginTicket, err := regexp.Compile(u.LoginTicketPattern)
+	if err != nil {
+		return errors.Wrap(err, "invalid login ticket pattern")
+	}
+	u.loginTicket = loginTicket
+	if u.InvalidPasswordPattern != "" {
+		u.invalidPassword, err = regexp.Compile(u.InvalidPasswordPattern)
+		if err != nil {
+			return errors.Wrap(err, "invalid invalid password pattern")
+		}
+	}
+	if u.AccountLockedPattern != "" {
+		u.accountLocked, err = regexp.Compile(u.AccountLockedPattern)
+		if err != nil {
+			return errors.Wrap(err, "invalid account locked pattern")
+		}
+	}
+
+	return nil
+}
+
+// casDefaults are the login form quirks of the Jasig CAS used by most universities.
+func casDefaults(u *University) *University {
+	u.LoginTicketPattern = "LT-[a-zA-Z0-9]+-[a-zA-Z0-9]+"
+	u.LoginQuery = map[string]string{
+		"locale": "pl",
+	}
+	u.LoginForm = map[string]string{
+		"execution": "e1s1",
+		"_eventId":  "submit",
+		"submit":    "ZALOGUJ",
+	}
+	u.InvalidPasswordPattern = "(?i)nieprawidłowy identyfikator lub hasło|cannot be determined to be authentic|invalid credentials"
+	u.AccountLockedPattern = "(?i)konto zostało zablokowane|account has been (locked|disabled)"
+	return u
+}
+
+// Builtin returns the universities known out of the box.
+func Builtin() []*University {
+	return []*University{
+		casDefaults(&University{
+			ID:          "mimuw",
+			Name:        "Uniwersytet Warszawski - MIMUW",
+			CASLoginURL: "https://logowanie.uw.edu.pl/cas/login",
+			USOSwebURL:  "https://usosweb.mimuw.edu.pl",
+			USOSAPIURL:  "https://usosapps.uw.edu.pl",
+		}),
+		casDefaults(&University{
+			ID:          "uw",
+			Name:        "Uniwersytet Warszawski",
+			CASLoginURL: "https://logowanie.uw.edu.pl/cas/login",
+			USOSwebURL:  "https://usosweb.uw.edu.pl",
+			USOSAPIURL:  "https://usosapps.uw.edu.pl",
+		}),
+	}
+}
+
+// Registry holds the supported universities.
+type Registry struct {
+	defaultID    string
+	universities map[string]*University
+}
+
+// NewRegistry creates a registry of the builtin universities and the ones from the given files.
+func NewRegistry(defaultID string, files ...string) (*Registry, error) {
+	r := &Registry{
+		defaultID:    defaultID,
+		universities: make(map[string]*University),
+	}
+	err := r.Add(Builtin()...)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		err := r.LoadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't load %v", path)
+		}
+	}
+	if _, ok := r.universities[defaultID]; !ok {
+		return nil, errors.Errorf("unknown default university %v", defaultID)
+	}
+
+	return r, nil
+}
+
+// Add adds the universities, replacing ones with the same ID.
+func (r *Registry) Add(universities ...*University) error {
+	for _, u := range universities {
+		err := u.compile()
+		if err != nil {
+			return errors.Wrapf(err, "invalid university %v", u.ID)
+		}
+		r.universities[u.ID] = u
+	}
+
+	return nil
+}
+
+// LoadFile adds the universities from a JSON file holding a list of them.
+func (r *Registry) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "couldn't read universities file")
+	}
+
+	var universities []*University
+	err = json.Unmarshal(data, &universities)
+	if err != nil {
+		return errors.Wrap(err, "couldn't decode universities file")
+	}
+
+	return r.Add(universities...)
+}
+
+// Get returns the university with the given ID, or the default one for an empty ID.
+func (r *Registry) Get(id string) (*University, error) {
+	if id == "" {
+		id = r.defaultID
+	}
+	u, ok := r.universities[id]
+	if !ok {
+		return nil, errors.Errorf("unknown university %v", id)
+	}
+
+	return u, nil
+}
+
+// List returns the universities sorted by name.
+func (r *Registry) List() []*University {
+	out := make([]*University, 0, len(r.universities))
+	for _, u := range r.universities {
+		out = append(out, u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
@@ -0,0 +1,66 @@
+package universities
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(DefaultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := r.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != DefaultID {
+		t.Errorf("expected the default university for an empty ID, got %v", u.ID)
+	}
+	if ticket := u.FindLoginTicket([]byte(`<input name="lt" value="LT-123-abc">`)); string(ticket) != "LT-123-abc" {
+		t.Errorf("unexpected login ticket %q", ticket)
+	}
+	if !u.IsInvalidPassword([]byte(`<div id="msg" class="errors">Nieprawidłowy identyfikator lub hasło.</div>`)) {
+		t.Error("expected an invalid password")
+	}
+	if !u.IsAccountLocked([]byte(`<div id="msg" class="errors">This account has been locked.</div>`)) {
+		t.Error("expected a locked account")
+	}
+	if u.IsInvalidPassword([]byte(`<input name="lt" value="LT-123-abc">`)) || u.IsAccountLocked([]byte(`<input name="lt" value="LT-123-abc">`)) {
+		t.Error("unexpected error on the login page")
+	}
+	if _, err := r.Get("unknown"); err == nil {
+		t.Error("expected error for an unknown university")
+	}
+
+	path := filepath.Join(t.TempDir(), "universities.json")
+	err = ioutil.WriteFile(path, []byte(`[{
+		"id": "example",
+		"name": "Example University",
+		"cas_login_url": "https://cas.example.com/cas/login",
+		"usosweb_url": "https://usosweb.example.com",
+		"login_ticket_pattern": "LT-[0-9]+"
+	}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	u, err = r.Get("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ServiceURL() != "https://usosweb.example.com/kontroler.php?_action=logowaniecas/index" {
+		t.Errorf("unexpected service url %v", u.ServiceURL())
+	}
+	if len(r.List()) != 3 {
+		t.Errorf("expected 3 universities, got %d", len(r.List()))
+	}
+
+	if _, err := NewRegistry("unknown"); err == nil {
+		t.Error("expected error for an unknown default university")
+	}
+}
@@ -0,0 +1,16 @@
+package users
+
+import (
+	"context"
+
+	"github.com/cube2222/grpc-utils/logger"
+)
+
+// LogKey is the log field holding the user ID.
+// It's the same as the user ID event attribute, so a single user's activity can be grepped across the services.
+const LogKey = "user_id"
+
+// WithLogger returns ctx with its logger enriched with the user ID.
+func WithLogger(ctx context.Context, userID UserID) context.Context {
+	return logger.Inject(ctx, logger.FromContext(ctx).With(logger.NewField(LogKey, userID.String())))
+}
@@ -1,11 +1,25 @@
 package users
 
+import (
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+)
+
 type UserID string
 
 func NewUserID(id string) UserID {
 	return UserID(id)
 }
 
+func GenerateUserID() (UserID, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't generate uuid")
+	}
+
+	return UserID(id.String()), nil
+}
+
 func (id UserID) String() string {
 	return string(id)
 }
@@ -0,0 +1,242 @@
+package usosapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnauthorized is returned when the USOS API rejects the token, usually because the user revoked it.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Consumer identifies this application to the USOS API, each USOS installation issues its own.
+type Consumer struct {
+	Key    string
+	Secret string
+}
+
+// Consumers pairs the consumer keys and secrets, both keyed by university ID.
+func Consumers(keys, secrets map[string]string) (map[string]Consumer, error) {
+	consumers := make(map[string]Consumer, len(keys))
+	for university, key := range keys {
+		secret, ok := secrets[university]
+		if !ok {
+			return nil, errors.Errorf("missing USOS API consumer secret for %v", university)
+		}
+		consumers[university] = Consumer{
+			Key:    key,
+			Secret: secret,
+		}
+	}
+
+	return consumers, nil
+}
+
+// Token is an OAuth 1.0a request or access token.
+type Token struct {
+	Token  string
+	Secret string
+}
+
+// Client calls the USOS API of a single university, signing the requests with OAuth 1.0a.
+type Client struct {
+	httpCli  *http.Client
+	baseURL  string
+	consumer Consumer
+}
+
+// NewClient creates a client of the USOS API at baseURL, e.g. https://usosapps.uw.edu.pl.
+func NewClient(httpCli *http.Client, baseURL string, consumer Consumer) *Client {
+	return &Client{
+		httpCli:  httpCli,
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		consumer: consumer,
+	}
+}
+
+// RequestToken starts the authorization, the user will be redirected to callback after authorizing the token.
+func (c *Client) RequestToken(ctx context.Context, callback string, scopes []string) (*Token, error) {
+	params := url.Values{}
+	params.Set("oauth_callback", callback)
+	if len(scopes) > 0 {
+		params.Set("scopes", strings.Join(scopes, "|"))
+	}
+
+	values, err := c.tokenRequest(ctx, "services/oauth/request_token", params, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get request token")
+	}
+	if values.Get("oauth_callback_confirmed") != "true" {
+		return nil, errors.New("callback not confirmed")
+	}
+
+	return &Token{
+		Token:  values.Get("oauth_token"),
+		Secret: values.Get("oauth_token_secret"),
+	}, nil
+}
+
+// AuthorizeURL is the page where the user authorizes the request token.
+func (c *Client) AuthorizeURL(requestToken *Token) string {
+	return c.baseURL + "/services/oauth/authorize?" + url.Values{"oauth_token": {requestToken.Token}}.Encode()
+}
+
+// AccessToken exchanges the authorized request token for an access token,
+// verifier is the oauth_verifier the user was redirected to the callback with.
+func (c *Client) AccessToken(ctx context.Context, requestToken *Token, verifier string) (*Token, error) {
+	params := url.Values{}
+	params.Set("oauth_verifier", verifier)
+
+	values, err := c.tokenRequest(ctx, "services/oauth/access_token", params, requestToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get access token")
+	}
+
+	return &Token{
+		Token:  values.Get("oauth_token"),
+		Secret: values.Get("oauth_token_secret"),
+	}, nil
+}
+
+func (c *Client) tokenRequest(ctx context.Context, method string, params url.Values, token *Token) (url.Values, error) {
+	body, err := c.do(ctx, method, params, token)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read response")
+	}
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse response")
+	}
+	if values.Get("oauth_token") == "" || values.Get("oauth_token_secret") == "" {
+		return nil, errors.New("missing token in response")
+	}
+
+	return values, nil
+}
+
+// Call calls the API method, e.g. services/users/user, with the access token and decodes the JSON response into out.
+func (c *Client) Call(ctx context.Context, method string, params url.Values, token *Token, out interface{}) error {
+	body, err := c.do(ctx, method, params, token)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	err = json.NewDecoder(body).Decode(out)
+	if err != nil {
+		return errors.Wrap(err, "couldn't decode response")
+	}
+
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method string, params url.Values, token *Token) (io.ReadCloser, error) {
+	endpoint := c.baseURL + "/" + method
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't generate nonce")
+	}
+	signed := sign(http.MethodPost, endpoint, params, c.consumer, token, nonce, time.Now())
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(signed.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(ctx)
+
+	res, err := c.httpCli.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't call %v", method)
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		if res.StatusCode == http.StatusUnauthorized {
+			return nil, ErrUnauthorized
+		}
+		return nil, errors.Errorf("received non-200 code from %v: %v", method, res.StatusCode)
+	}
+
+	return res.Body, nil
+}
+
+// sign returns the params together with the OAuth 1.0a protocol parameters and the HMAC-SHA1 signature.
+func sign(method, endpoint string, params url.Values, consumer Consumer, token *Token, nonce string, now time.Time) url.Values {
+	signed := url.Values{}
+	for key, values := range params {
+		signed[key] = append([]string(nil), values...)
+	}
+	signed.Set("oauth_consumer_key", consumer.Key)
+	signed.Set("oauth_nonce", nonce)
+	signed.Set("oauth_signature_method", "HMAC-SHA1")
+	signed.Set("oauth_timestamp", strconv.FormatInt(now.Unix(), 10))
+	signed.Set("oauth_version", "1.0")
+	tokenSecret := ""
+	if token != nil {
+		signed.Set("oauth_token", token.Token)
+		tokenSecret = token.Secret
+	}
+
+	pairs := make([]string, 0, len(signed))
+	for key, values := range signed {
+		for _, value := range values {
+			pairs = append(pairs, percentEncode(key)+"="+percentEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+
+	base := strings.Join([]string{
+		method,
+		percentEncode(endpoint),
+		percentEncode(strings.Join(pairs, "&")),
+	}, "&")
+	mac := hmac.New(sha1.New, []byte(percentEncode(consumer.Secret)+"&"+percentEncode(tokenSecret)))
+	mac.Write([]byte(base))
+	signed.Set("oauth_signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return signed
+}
+
+// percentEncode encodes s as specified by RFC 5849, leaving only unreserved characters.
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteString(strings.ToUpper(hex.EncodeToString([]byte{c})))
+	}
+	return b.String()
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,126 @@
+package usosapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// The example from the OAuth 1.0 specification, appendix A.5.
+	params := url.Values{}
+	params.Set("file", "vacation.jpg")
+	params.Set("size", "original")
+
+	signed := sign(
+		http.MethodGet,
+		"http://photos.example.net/photos",
+		params,
+		Consumer{Key: "dpf43f3p2l4k3l03", Secret: "kd94hf93k423kf44"},
+		&Token{Token: "nnch734d00sl2jdk", Secret: "pfkkdhi9sl3r4s00"},
+		"kllo9940pd9333jh",
+		time.Unix(1191242096, 0),
+	)
+
+	if signature := signed.Get("oauth_signature"); signature != "tR3+Ty81lMeYAr/Fid0kMTYa/WM=" {
+		t.Errorf("unexpected signature %v", signature)
+	}
+	if params.Get("oauth_signature") != "" {
+		t.Error("params were modified")
+	}
+}
+
+func TestClient(t *testing.T) {
+	consumer := Consumer{Key: "key", Secret: "secret"}
+	requestToken := &Token{Token: "request", Secret: "request-secret"}
+	accessToken := &Token{Token: "access", Secret: "access-secret"}
+
+	var server *httptest.Server
+	verify := func(r *http.Request, token *Token) bool {
+		if err := r.ParseForm(); err != nil {
+			return false
+		}
+		params := url.Values{}
+		for key, values := range r.PostForm {
+			switch key {
+			case "oauth_consumer_key", "oauth_nonce", "oauth_signature_method", "oauth_timestamp", "oauth_version", "oauth_token", "oauth_signature":
+			default:
+				params[key] = values
+			}
+		}
+		timestamp, err := strconv.ParseInt(r.PostForm.Get("oauth_timestamp"), 10, 64)
+		if err != nil {
+			return false
+		}
+		expected := sign(r.Method, server.URL+r.URL.Path, params, consumer, token, r.PostForm.Get("oauth_nonce"), time.Unix(timestamp, 0))
+		return r.PostForm.Get("oauth_signature") == expected.Get("oauth_signature")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services/oauth/request_token", func(w http.ResponseWriter, r *http.Request) {
+		if !verify(r, nil) || r.PostForm.Get("scopes") != "studies|offline_access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "oauth_token=%s&oauth_token_secret=%s&oauth_callback_confirmed=true", requestToken.Token, requestToken.Secret)
+	})
+	mux.HandleFunc("/services/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if !verify(r, requestToken) || r.PostForm.Get("oauth_verifier") != "verifier" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "oauth_token=%s&oauth_token_secret=%s", accessToken.Token, accessToken.Secret)
+	})
+	mux.HandleFunc("/services/users/user", func(w http.ResponseWriter, r *http.Request) {
+		if !verify(r, accessToken) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"id": "123"}`)
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx := context.Background()
+	cli := NewClient(server.Client(), server.URL, consumer)
+
+	token, err := cli.RequestToken(ctx, "https://example.com/callback", []string{"studies", "offline_access"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *token != *requestToken {
+		t.Errorf("unexpected request token %+v", token)
+	}
+	if cli.AuthorizeURL(token) != server.URL+"/services/oauth/authorize?oauth_token=request" {
+		t.Errorf("unexpected authorize url %v", cli.AuthorizeURL(token))
+	}
+
+	token, err = cli.AccessToken(ctx, token, "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *token != *accessToken {
+		t.Errorf("unexpected access token %+v", token)
+	}
+
+	var user struct {
+		ID string `json:"id"`
+	}
+	err = cli.Call(ctx, "services/users/user", url.Values{"fields": {"id"}}, token, &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != "123" {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	err = cli.Call(ctx, "services/users/user", nil, requestToken, &user)
+	if err != ErrUnauthorized {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
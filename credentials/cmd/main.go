@@ -10,16 +10,24 @@ import (
 
 	gdatastore "cloud.google.com/go/datastore"
 	"cloud.google.com/go/pubsub"
+	"github.com/cube2222/usos-notifier/common/events/outbox"
+	outboxdatastore "github.com/cube2222/usos-notifier/common/events/outbox/datastore"
 	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/events/recording"
 	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	subscriberdatastore "github.com/cube2222/usos-notifier/common/events/subscriber/datastore"
+	"github.com/cube2222/usos-notifier/common/events/transport/cloudpubsub"
+	"github.com/cube2222/usos-notifier/common/lifecycle"
+	"github.com/cube2222/usos-notifier/common/metrics"
+	"github.com/cube2222/usos-notifier/common/tracing"
+	"github.com/cube2222/usos-notifier/common/universities"
 	"github.com/cube2222/usos-notifier/credentials/resources"
 	"github.com/cube2222/usos-notifier/credentials/service/datastore"
 	"github.com/cube2222/usos-notifier/notifier"
 	"github.com/go-chi/chi"
 	"github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/kelseyhightower/envconfig"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/cloudkms/v1"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 
@@ -28,6 +36,7 @@ import (
 	"github.com/cube2222/grpc-utils/requestid"
 
 	"github.com/cube2222/usos-notifier/credentials"
+	"github.com/cube2222/usos-notifier/credentials/encryption"
 	"github.com/cube2222/usos-notifier/credentials/service"
 )
 
@@ -35,14 +44,18 @@ func main() {
 	config := &credentials.Config{}
 	envconfig.MustProcess("credentials", config)
 
-	httpCli, err := google.DefaultClient(context.Background(), cloudkms.CloudPlatformScope)
+	keyring, err := config.Encryption.Keyring(context.Background(), config.EncryptionKeyID)
 	if err != nil {
-		log.Fatal("Couldn't setup google default http client: ", err)
+		log.Fatal("Couldn't create encryption keyring: ", err)
 	}
-	kms, err := cloudkms.New(httpCli)
-	if err != nil {
-		log.Fatal("Couldn't create cloud kms client", err)
+	if config.Encryption.Backend == encryption.BackendNone {
+		log.Println("Credentials are stored unencrypted, don't use this in production.")
 	}
+	additionalData := encryption.NewAdditionalData(
+		config.AdditionalAuthenticatedDataVersion,
+		config.AdditionalAuthenticatedData,
+		config.PreviousAdditionalAuthenticatedData,
+	)
 	ds, err := gdatastore.NewClient(context.Background(), config.ProjectName, option.WithCredentialsFile(config.GoogleApplicationCredentials))
 	if err != nil {
 		log.Fatal("Couldn't create datastore client", err)
@@ -51,12 +64,58 @@ func main() {
 	if err != nil {
 		log.Fatal("Couldn't create pubsub client", err)
 	}
+	pubsubTransport := cloudpubsub.
+		NewTransport(pubsubCli).
+		WithBatching(cloudpubsub.BatchSettings{
+			CountThreshold: config.PublishBatchCount,
+			ByteThreshold:  config.PublishBatchBytes,
+			DelayThreshold: config.PublishBatchDelay,
+		})
+	err = pubsubTransport.Declare(context.Background(), config.NotificationsTopic, config.CredentialsReceivedTopic, config.CredentialsInvalidatedTopic, config.DeadLetterTopic)
+	if err != nil {
+		log.Fatal("Couldn't declare pubsub topics: ", err)
+	}
+
+	lc := lifecycle.New(config.ShutdownTimeout)
+	shutdownTracing, err := tracing.Init("credentials", config.TracingExporter, config.TracingFile)
+	if err != nil {
+		log.Fatal("Couldn't set up tracing: ", err)
+	}
+	lc.OnShutdown("tracing", shutdownTracing)
+	lc.OnShutdown("pubsub", func(ctx context.Context) error {
+		pubsubTransport.Stop()
+		return pubsubCli.Close()
+	})
 
-	credentialsStorage := datastore.NewCredentialsStorage(ds, kms, config.EncryptionKeyID, config.AdditionalAuthenticatedData)
+	recorder, err := recording.NewFileRecorder(config.RecordingFile, config.RecordingMaxSize, config.RecordingMaxFiles)
+	if err != nil {
+		log.Fatal("Couldn't create event recorder: ", err)
+	}
+	lc.OnShutdown("recorder", func(ctx context.Context) error {
+		return recorder.Close()
+	})
+	chainDeps := subscriber.ChainDeps{
+		Logger:          logger.NewStdLogger(),
+		Recorder:        recorder,
+		SeenStore:       subscriberdatastore.NewSeenStore(ds, config.DeduplicationRetention),
+		DeadLetter:      pubsubTransport,
+		DeadLetterTopic: config.DeadLetterTopic,
+		Retry: subscriber.RetryConfig{
+			MaxAttempts:    config.MaxDeliveryAttempts,
+			InitialBackoff: config.RetryInitialBackoff,
+			MaxBackoff:     config.RetryMaxBackoff,
+		},
+	}
+
+	credentialsStorage := datastore.NewCredentialsStorage(ds, keyring, additionalData, config.RejectLegacyRecords)
 	tokenStorage := datastore.NewTokenStorage(ds)
 	pub := publisher.
-		NewPublisher(pubsubCli).
-		Use(publisher.WithRequestID)
+		NewPublisher(pubsubTransport).
+		WithContentEncoding(config.PublishContentEncoding).
+		Use(publisher.WithRequestID).
+		Use(publisher.WithTracing).
+		Use(publisher.WithMetrics)
+	lc.OnShutdown("publisher", pub.Stop)
 	notificationSender := notifier.NewNotificationSender(
 		pub,
 		config.NotificationsTopic,
@@ -71,57 +130,102 @@ func main() {
 		log.Fatal(err)
 	}
 
-	s, err := service.NewService(credentialsStorage, tokenStorage, notificationSender, pub, tmpl, config.CredentialsReceivedTopic)
+	var universitiesFiles []string
+	if config.UniversitiesFile != "" {
+		universitiesFiles = append(universitiesFiles, config.UniversitiesFile)
+	}
+	universitiesRegistry, err := universities.NewRegistry(config.DefaultUniversity, universitiesFiles...)
+	if err != nil {
+		log.Fatal("Couldn't create universities registry: ", err)
+	}
+
+	s, err := service.NewService(credentialsStorage, tokenStorage, notificationSender, tmpl, universitiesRegistry, config.CredentialsReceivedTopic, config.CredentialsInvalidatedTopic, config.SessionCacheTTL, config.MaxInvalidPasswordFailures)
 	if err != nil {
 		log.Fatal(err, "Couldn't create service")
 	}
+	usosAPIConsumers, err := config.UsosApiConsumers()
+	if err != nil {
+		log.Fatal("Couldn't get USOS API consumers: ", err)
+	}
+	if len(usosAPIConsumers) > 0 {
+		s.WithUSOSAPI(datastore.NewPendingAuthorizationStorage(ds), usosAPIConsumers, config.UsosApiCallbackUrl)
+	}
 
 	// Set up grpc usos sessions service
 	server := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
 		grpc.UnaryInterceptor(
 			grpc_middleware.ChainUnaryServer(
 				requestid.ServerInterceptor(),
 				logger.GRPCInjector(logger.NewStdLogger(), requestid.Key),
 				logger.GRPCServerLogger(),
+				metrics.GRPCServerInterceptor(),
 			),
 		),
 	)
 	credentials.RegisterCredentialsServer(server, s)
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%v", config.ListenPortGrpc))
-	go func() {
-		log.Fatal(server.Serve(lis))
-	}()
+	if err != nil {
+		log.Fatal("Couldn't listen for grpc: ", err)
+	}
+	lc.ServeGRPC("grpc server", server, lis)
 
 	// Set up authorization page handler
 	m := chi.NewMux()
 	m.Use(requestid.HTTPInterceptor)
+	m.Use(tracing.HTTPInterceptor)
+	m.Use(metrics.HTTPInterceptor)
 	m.Use(logger.HTTPInjector(logger.NewStdLogger(), requestid.Key))
 	m.Use(logger.HTTPLogger())
 	m.HandleFunc("/credentials/authorization", s.HandleAuthorizationPageHTTP)
 	m.HandleFunc("/credentials/authorize", s.HandleAuthorizeHTTP)
-	go func() {
-		log.Println("Serving...")
-		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", config.ListenPortHttp), m))
-	}()
+	m.HandleFunc("/credentials/authorize/usos", s.HandleAuthorizeUSOSAPIHTTP)
+	m.HandleFunc("/credentials/authorize/usos/callback", s.HandleUSOSAPICallbackHTTP)
+	lc.ServeHTTP("http server", &http.Server{
+		Addr:    fmt.Sprintf(":%v", config.ListenPortHttp),
+		Handler: m,
+	})
+	log.Println("Serving...")
+
+	// Set up publishing of the events saved in the outbox
+	relay := outbox.NewRelay(outboxdatastore.NewStore(ds), pub, config.OutboxRelayInterval, config.OutboxRelayTimeout, config.OutboxBatchSize, config.OutboxMaxAttempts)
+	lc.Go("outbox relay", relay.Run)
 
 	// Set up user created event subscription
-	go func() {
-		log.Fatal(
-			subscriber.
-				NewSubscriptionClient(pubsubCli).
-				Subscribe(
-					context.Background(),
-					config.UserCreatedSubscription,
-					subscriber.Chain(
-						s.HandleUserCreatedEvent,
-						subscriber.WithLogger(logger.NewStdLogger()),
-						subscriber.WithRequestID,
-						subscriber.WithLogging(requestid.Key),
-					),
-				),
-		)
-	}()
+	lc.Go("user created subscription", func(ctx context.Context) error {
+		return subscriber.
+			NewSubscriptionClient(pubsubTransport).
+			WithReceiveSettings(config.UserCreatedFlowControl.ReceiveSettings()).
+			SubscribeTyped(
+				ctx,
+				config.UserCreatedSubscription,
+				notifier.UserCreatedEventName,
+				s.HandleUserCreatedEvent,
+				subscriber.DefaultChain("credentials.HandleUserCreatedEvent", chainDeps, config.UserCreatedFlowControl.MaxConcurrentHandlers)...,
+			)
+	})
+
+	// Set up credentials invalidated event subscription
+	lc.Go("credentials invalidated subscription", func(ctx context.Context) error {
+		return subscriber.
+			NewSubscriptionClient(pubsubTransport).
+			WithReceiveSettings(config.CredentialsInvalidatedFlowControl.ReceiveSettings()).
+			SubscribeTyped(
+				ctx,
+				config.CredentialsInvalidatedSubscription,
+				credentials.CredentialsInvalidatedEventName,
+				s.HandleCredentialsInvalidatedEvent,
+				subscriber.DefaultChain("credentials.HandleCredentialsInvalidatedEvent", chainDeps, config.CredentialsInvalidatedFlowControl.MaxConcurrentHandlers)...,
+			)
+	})
+
+	lc.ServeHTTP("metrics server", metrics.NewServer(config.ListenPortMetrics))
 
 	// Set up health checking
-	health.LaunchHealthCheckHandler()
+	go health.LaunchHealthCheckHandler()
+
+	err = lc.Wait()
+	if err != nil {
+		log.Fatal(err)
+	}
 }
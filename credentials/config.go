@@ -1,14 +1,85 @@
 package credentials
 
+import (
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	"github.com/cube2222/usos-notifier/common/usosapi"
+	"github.com/cube2222/usos-notifier/credentials/encryption"
+)
+
 type Config struct {
-	ListenPortHttp int `default:"8080" split_words:"true"`
-	ListenPortGrpc int `default:"8081" split_words:"true"`
-
-	ProjectName                  string `default:"usos-notifier" split_words:"true"`
-	AdditionalAuthenticatedData  string `default:"something" split_word:"true"`
-	EncryptionKeyID              string `default:"projects/usos-notifier/locations/global/keyRings/credentials/cryptoKeys/credentials" split_word:"true"`
-	CredentialsReceivedTopic     string `default:"credentials-credentials_received" split_words:"true"`
-	NotificationsTopic           string `default:"notifications" split_words:"true"`
-	UserCreatedSubscription      string `default:"credentials-notifier-user_created" split_words:"true"`
-	GoogleApplicationCredentials string `default:"/var/secrets/google/serviceaccount.json" split_words:"true"`
+	ListenPortHttp    int `default:"8080" split_words:"true"`
+	ListenPortGrpc    int `default:"8081" split_words:"true"`
+	ListenPortMetrics int `default:"9090" split_words:"true"`
+
+	ProjectName                        string `default:"usos-notifier" split_words:"true"`
+	AdditionalAuthenticatedData        string `default:"something" split_word:"true"`
+	EncryptionKeyID                    string `default:"projects/usos-notifier/locations/global/keyRings/credentials/cryptoKeys/credentials" split_word:"true"`
+	CredentialsReceivedTopic           string `default:"credentials-credentials_received" split_words:"true"`
+	CredentialsInvalidatedTopic        string `default:"credentials-credentials_invalidated" split_words:"true"`
+	NotificationsTopic                 string `default:"notifications" split_words:"true"`
+	DeadLetterTopic                    string `default:"dead_letter" split_words:"true"`
+	UserCreatedSubscription            string `default:"credentials-notifier-user_created" split_words:"true"`
+	CredentialsInvalidatedSubscription string `default:"credentials-credentials-credentials_invalidated" split_words:"true"`
+	GoogleApplicationCredentials       string `default:"/var/secrets/google/serviceaccount.json" split_words:"true"`
+
+	// Encryption selects the backend, the current Cloud KMS key is EncryptionKeyID.
+	Encryption encryption.Config `split_words:"true"`
+	// Credentials saved with previous versions of the additional authenticated data can still be read,
+	// until they're re-encrypted. Credentials saved before versioning use version 1.
+	AdditionalAuthenticatedDataVersion  string            `default:"1" split_words:"true"`
+	PreviousAdditionalAuthenticatedData map[string]string `split_words:"true"`
+	// RejectLegacyRecords refuses credentials not bound to their user, enable it once the re-encryption job reports none are left.
+	RejectLegacyRecords bool `split_words:"true"`
+
+	// UniversitiesFile is an optional JSON list of universities added to the builtin ones.
+	DefaultUniversity string `default:"mimuw" split_words:"true"`
+	UniversitiesFile  string `split_words:"true"`
+
+	// Authorizing through the USOS API is available for universities with a consumer key and secret,
+	// keyed by university ID, e.g. "uw:key,mimuw:key".
+	UsosApiConsumerKeys    map[string]string `split_words:"true"`
+	UsosApiConsumerSecrets map[string]string `split_words:"true"`
+	UsosApiCallbackUrl     string            `default:"https://notifier.jacobmartins.com/credentials/authorize/usos/callback" split_words:"true"`
+
+	MaxDeliveryAttempts    int           `default:"5" split_words:"true"`
+	RetryInitialBackoff    time.Duration `default:"1s" split_words:"true"`
+	RetryMaxBackoff        time.Duration `default:"1m" split_words:"true"`
+	DeduplicationRetention time.Duration `default:"168h" split_words:"true"`
+	ShutdownTimeout        time.Duration `default:"25s" split_words:"true"`
+	SessionCacheTTL        time.Duration `default:"10m" split_words:"true"`
+	OutboxRelayInterval    time.Duration `default:"1s" split_words:"true"`
+	OutboxRelayTimeout     time.Duration `default:"20s" split_words:"true"`
+	OutboxBatchSize        int           `default:"100" split_words:"true"`
+
+	// Outbox events failing to publish OutboxMaxAttempts times are moved aside, so they don't hold up the later ones.
+	OutboxMaxAttempts int `default:"10" split_words:"true"`
+
+	// Credentials are marked stale after MaxInvalidPasswordFailures consecutive logins failed because of an invalid password,
+	// the user is then asked to authorize again.
+	MaxInvalidPasswordFailures int `default:"3" split_words:"true"`
+
+	PublishBatchCount int           `default:"100" split_words:"true"`
+	PublishBatchBytes int           `default:"1000000" split_words:"true"`
+	PublishBatchDelay time.Duration `default:"10ms" split_words:"true"`
+
+	// PublishContentEncoding is base64 or raw, switch to raw only once all subscribers of the topics are upgraded.
+	PublishContentEncoding string `default:"base64" split_words:"true"`
+
+	UserCreatedFlowControl            subscriber.FlowControlConfig `split_words:"true"`
+	CredentialsInvalidatedFlowControl subscriber.FlowControlConfig `split_words:"true"`
+
+	TracingExporter string `default:"none" split_words:"true"`
+	TracingFile     string `default:"traces.json" split_words:"true"`
+
+	// Handled events are recorded to RecordingFile if it's set, for debugging with the replay tool.
+	RecordingFile     string `split_words:"true"`
+	RecordingMaxSize  int64  `default:"104857600" split_words:"true"`
+	RecordingMaxFiles int    `default:"5" split_words:"true"`
+}
+
+// UsosApiConsumers returns the USOS API consumers by university ID.
+func (c *Config) UsosApiConsumers() (map[string]usosapi.Consumer, error) {
+	return usosapi.Consumers(c.UsosApiConsumerKeys, c.UsosApiConsumerSecrets)
 }
@@ -2,18 +2,68 @@ package credentials
 
 import (
 	"context"
+	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/outbox"
 	"github.com/cube2222/usos-notifier/common/users"
 )
 
+var ErrCredentialsNotFound = errors.New("credentials not found")
+
 type CredentialsStorage interface {
+	// GetCredentials returns ErrCredentialsNotFound for users who haven't provided any.
 	GetCredentials(ctx context.Context, userID users.UserID) (*Credentials, error)
-	SaveCredentials(ctx context.Context, userID users.UserID, user, password string) error
+	// SaveCredentials saves the credentials together with the outbox events, in a single transaction.
+	// The creation and update times are set by the storage.
+	SaveCredentials(ctx context.Context, userID users.UserID, creds *Credentials, events ...*outbox.Event) error
+	// SetLastLogin also resets the count of invalid password failures. Logins shortly after the last one saved may be skipped.
+	SetLastLogin(ctx context.Context, userID users.UserID, lastLogin time.Time) error
+	// RecordInvalidPassword counts a login failing because of an invalid password. After maxFailures consecutive
+	// failures the credentials are marked stale, saving the events in the same transaction. It reports whether
+	// the credentials have just been marked stale.
+	RecordInvalidPassword(ctx context.Context, userID users.UserID, maxFailures int, events ...*outbox.Event) (bool, error)
 }
 
+// Credentials hold either the password, or the USOS API access token of users who authorized through the USOS API.
 type Credentials struct {
 	User     string
 	Password string
+	// AccessToken and AccessTokenSecret are the USOS API access token.
+	AccessToken       string
+	AccessTokenSecret string
+	// University is empty for credentials saved before universities were supported.
+	University string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	// LastLogin is the last time the credentials were successfully used to log in.
+	LastLogin time.Time
+	// InvalidPasswordFailures is the number of consecutive logins which failed because of an invalid password.
+	InvalidPasswordFailures int
+	// Stale credentials stopped working, they aren't used until the user authorizes again.
+	Stale bool
+}
+
+// HasAccessToken reports whether the user authorized through the USOS API instead of providing their password.
+func (c *Credentials) HasAccessToken() bool {
+	return c.AccessToken != ""
+}
+
+// PendingAuthorization is a USOS API authorization the user hasn't finished yet.
+type PendingAuthorization struct {
+	// Token is the authorization token the user got from the TokenStorage.
+	Token              string
+	University         string
+	RequestTokenSecret string
+	CreatedAt          time.Time
+}
+
+// PendingAuthorizationStorage stores pending USOS API authorizations by their request token.
+type PendingAuthorizationStorage interface {
+	SavePendingAuthorization(ctx context.Context, requestToken string, authorization *PendingAuthorization) error
+	// TakePendingAuthorization returns and deletes the pending authorization, so it can be used only once.
+	TakePendingAuthorization(ctx context.Context, requestToken string) (*PendingAuthorization, error)
 }
 
 type TokenStorage interface {
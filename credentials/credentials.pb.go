@@ -10,6 +10,12 @@ It is generated from these files:
 It has these top-level messages:
 	GetSessionRequest
 	GetSessionResponse
+	InvalidateSessionRequest
+	InvalidateSessionResponse
+	GetAccessTokenRequest
+	GetAccessTokenResponse
+	InvalidateAccessTokenRequest
+	InvalidateAccessTokenResponse
 */
 package credentials
 
@@ -51,6 +57,10 @@ func (m *GetSessionRequest) GetUserid() string {
 
 type GetSessionResponse struct {
 	Sessionid string `protobuf:"bytes,1,opt,name=sessionid" json:"sessionid,omitempty"`
+	// university is the ID of the university the session is for.
+	University string `protobuf:"bytes,2,opt,name=university" json:"university,omitempty"`
+	// usosweb_url is the base URL of the USOSweb the session is valid for.
+	UsoswebUrl string `protobuf:"bytes,3,opt,name=usosweb_url,json=usoswebUrl" json:"usosweb_url,omitempty"`
 }
 
 func (m *GetSessionResponse) Reset()                    { *m = GetSessionResponse{} }
@@ -65,9 +75,152 @@ func (m *GetSessionResponse) GetSessionid() string {
 	return ""
 }
 
+func (m *GetSessionResponse) GetUniversity() string {
+	if m != nil {
+		return m.University
+	}
+	return ""
+}
+
+func (m *GetSessionResponse) GetUsoswebUrl() string {
+	if m != nil {
+		return m.UsoswebUrl
+	}
+	return ""
+}
+
+type InvalidateSessionRequest struct {
+	Userid string `protobuf:"bytes,1,opt,name=userid" json:"userid,omitempty"`
+	// sessionid is the expired session, a newer cached session is kept. Empty drops any cached session.
+	Sessionid string `protobuf:"bytes,2,opt,name=sessionid" json:"sessionid,omitempty"`
+}
+
+func (m *InvalidateSessionRequest) Reset()                    { *m = InvalidateSessionRequest{} }
+func (m *InvalidateSessionRequest) String() string            { return proto.CompactTextString(m) }
+func (*InvalidateSessionRequest) ProtoMessage()               {}
+func (*InvalidateSessionRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *InvalidateSessionRequest) GetUserid() string {
+	if m != nil {
+		return m.Userid
+	}
+	return ""
+}
+
+func (m *InvalidateSessionRequest) GetSessionid() string {
+	if m != nil {
+		return m.Sessionid
+	}
+	return ""
+}
+
+type InvalidateSessionResponse struct {
+}
+
+func (m *InvalidateSessionResponse) Reset()                    { *m = InvalidateSessionResponse{} }
+func (m *InvalidateSessionResponse) String() string            { return proto.CompactTextString(m) }
+func (*InvalidateSessionResponse) ProtoMessage()               {}
+func (*InvalidateSessionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+type GetAccessTokenRequest struct {
+	Userid string `protobuf:"bytes,1,opt,name=userid" json:"userid,omitempty"`
+}
+
+func (m *GetAccessTokenRequest) Reset()                    { *m = GetAccessTokenRequest{} }
+func (m *GetAccessTokenRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetAccessTokenRequest) ProtoMessage()               {}
+func (*GetAccessTokenRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *GetAccessTokenRequest) GetUserid() string {
+	if m != nil {
+		return m.Userid
+	}
+	return ""
+}
+
+type GetAccessTokenResponse struct {
+	Token       string `protobuf:"bytes,1,opt,name=token" json:"token,omitempty"`
+	TokenSecret string `protobuf:"bytes,2,opt,name=token_secret,json=tokenSecret" json:"token_secret,omitempty"`
+	University  string `protobuf:"bytes,5,opt,name=university" json:"university,omitempty"`
+	// usosapi_url is the base URL of the USOS API of the university.
+	UsosapiUrl string `protobuf:"bytes,6,opt,name=usosapi_url,json=usosapiUrl" json:"usosapi_url,omitempty"`
+}
+
+func (m *GetAccessTokenResponse) Reset()                    { *m = GetAccessTokenResponse{} }
+func (m *GetAccessTokenResponse) String() string            { return proto.CompactTextString(m) }
+func (*GetAccessTokenResponse) ProtoMessage()               {}
+func (*GetAccessTokenResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *GetAccessTokenResponse) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+func (m *GetAccessTokenResponse) GetTokenSecret() string {
+	if m != nil {
+		return m.TokenSecret
+	}
+	return ""
+}
+
+func (m *GetAccessTokenResponse) GetUniversity() string {
+	if m != nil {
+		return m.University
+	}
+	return ""
+}
+
+func (m *GetAccessTokenResponse) GetUsosapiUrl() string {
+	if m != nil {
+		return m.UsosapiUrl
+	}
+	return ""
+}
+
+type InvalidateAccessTokenRequest struct {
+	Userid string `protobuf:"bytes,1,opt,name=userid" json:"userid,omitempty"`
+	// token is the rejected access token, a newer one is kept.
+	Token string `protobuf:"bytes,2,opt,name=token" json:"token,omitempty"`
+}
+
+func (m *InvalidateAccessTokenRequest) Reset()                    { *m = InvalidateAccessTokenRequest{} }
+func (m *InvalidateAccessTokenRequest) String() string            { return proto.CompactTextString(m) }
+func (*InvalidateAccessTokenRequest) ProtoMessage()               {}
+func (*InvalidateAccessTokenRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *InvalidateAccessTokenRequest) GetUserid() string {
+	if m != nil {
+		return m.Userid
+	}
+	return ""
+}
+
+func (m *InvalidateAccessTokenRequest) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+type InvalidateAccessTokenResponse struct {
+}
+
+func (m *InvalidateAccessTokenResponse) Reset()                    { *m = InvalidateAccessTokenResponse{} }
+func (m *InvalidateAccessTokenResponse) String() string            { return proto.CompactTextString(m) }
+func (*InvalidateAccessTokenResponse) ProtoMessage()               {}
+func (*InvalidateAccessTokenResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
 func init() {
 	proto.RegisterType((*GetSessionRequest)(nil), "credentials.GetSessionRequest")
 	proto.RegisterType((*GetSessionResponse)(nil), "credentials.GetSessionResponse")
+	proto.RegisterType((*InvalidateSessionRequest)(nil), "credentials.InvalidateSessionRequest")
+	proto.RegisterType((*InvalidateSessionResponse)(nil), "credentials.InvalidateSessionResponse")
+	proto.RegisterType((*GetAccessTokenRequest)(nil), "credentials.GetAccessTokenRequest")
+	proto.RegisterType((*GetAccessTokenResponse)(nil), "credentials.GetAccessTokenResponse")
+	proto.RegisterType((*InvalidateAccessTokenRequest)(nil), "credentials.InvalidateAccessTokenRequest")
+	proto.RegisterType((*InvalidateAccessTokenResponse)(nil), "credentials.InvalidateAccessTokenResponse")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -81,7 +234,17 @@ const _ = grpc.SupportPackageIsVersion4
 // Client API for Credentials service
 
 type CredentialsClient interface {
+	// GetSession fails with INVALID_ARGUMENT for users who authorized through the USOS API, other codes are login errors.
 	GetSession(ctx context.Context, in *GetSessionRequest, opts ...grpc.CallOption) (*GetSessionResponse, error)
+	// InvalidateSession drops the cached session, so the next GetSession logs in again.
+	InvalidateSession(ctx context.Context, in *InvalidateSessionRequest, opts ...grpc.CallOption) (*InvalidateSessionResponse, error)
+	// GetAccessToken returns the USOS API access token of users who authorized through the USOS API.
+	// It fails with FAILED_PRECONDITION for users who provided their password instead,
+	// and with UNAUTHENTICATED once the token got rejected, until the user authorizes again.
+	GetAccessToken(ctx context.Context, in *GetAccessTokenRequest, opts ...grpc.CallOption) (*GetAccessTokenResponse, error)
+	// InvalidateAccessToken reports an access token rejected by the USOS API, the credentials are marked stale
+	// and the user is asked to authorize again. A token other than the stored one is ignored.
+	InvalidateAccessToken(ctx context.Context, in *InvalidateAccessTokenRequest, opts ...grpc.CallOption) (*InvalidateAccessTokenResponse, error)
 }
 
 type credentialsClient struct {
@@ -101,10 +264,47 @@ func (c *credentialsClient) GetSession(ctx context.Context, in *GetSessionReques
 	return out, nil
 }
 
+func (c *credentialsClient) InvalidateSession(ctx context.Context, in *InvalidateSessionRequest, opts ...grpc.CallOption) (*InvalidateSessionResponse, error) {
+	out := new(InvalidateSessionResponse)
+	err := grpc.Invoke(ctx, "/credentials.Credentials/InvalidateSession", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *credentialsClient) GetAccessToken(ctx context.Context, in *GetAccessTokenRequest, opts ...grpc.CallOption) (*GetAccessTokenResponse, error) {
+	out := new(GetAccessTokenResponse)
+	err := grpc.Invoke(ctx, "/credentials.Credentials/GetAccessToken", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *credentialsClient) InvalidateAccessToken(ctx context.Context, in *InvalidateAccessTokenRequest, opts ...grpc.CallOption) (*InvalidateAccessTokenResponse, error) {
+	out := new(InvalidateAccessTokenResponse)
+	err := grpc.Invoke(ctx, "/credentials.Credentials/InvalidateAccessToken", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Credentials service
 
 type CredentialsServer interface {
+	// GetSession fails with INVALID_ARGUMENT for users who authorized through the USOS API, other codes are login errors.
 	GetSession(context.Context, *GetSessionRequest) (*GetSessionResponse, error)
+	// InvalidateSession drops the cached session, so the next GetSession logs in again.
+	InvalidateSession(context.Context, *InvalidateSessionRequest) (*InvalidateSessionResponse, error)
+	// GetAccessToken returns the USOS API access token of users who authorized through the USOS API.
+	// It fails with FAILED_PRECONDITION for users who provided their password instead,
+	// and with UNAUTHENTICATED once the token got rejected, until the user authorizes again.
+	GetAccessToken(context.Context, *GetAccessTokenRequest) (*GetAccessTokenResponse, error)
+	// InvalidateAccessToken reports an access token rejected by the USOS API, the credentials are marked stale
+	// and the user is asked to authorize again. A token other than the stored one is ignored.
+	InvalidateAccessToken(context.Context, *InvalidateAccessTokenRequest) (*InvalidateAccessTokenResponse, error)
 }
 
 func RegisterCredentialsServer(s *grpc.Server, srv CredentialsServer) {
@@ -129,6 +329,60 @@ func _Credentials_GetSession_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Credentials_InvalidateSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvalidateSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CredentialsServer).InvalidateSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/credentials.Credentials/InvalidateSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CredentialsServer).InvalidateSession(ctx, req.(*InvalidateSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Credentials_GetAccessToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAccessTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CredentialsServer).GetAccessToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/credentials.Credentials/GetAccessToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CredentialsServer).GetAccessToken(ctx, req.(*GetAccessTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Credentials_InvalidateAccessToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvalidateAccessTokenRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CredentialsServer).InvalidateAccessToken(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/credentials.Credentials/InvalidateAccessToken",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CredentialsServer).InvalidateAccessToken(ctx, req.(*InvalidateAccessTokenRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _Credentials_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "credentials.Credentials",
 	HandlerType: (*CredentialsServer)(nil),
@@ -137,6 +391,18 @@ var _Credentials_serviceDesc = grpc.ServiceDesc{
 			MethodName: "GetSession",
 			Handler:    _Credentials_GetSession_Handler,
 		},
+		{
+			MethodName: "InvalidateSession",
+			Handler:    _Credentials_InvalidateSession_Handler,
+		},
+		{
+			MethodName: "GetAccessToken",
+			Handler:    _Credentials_GetAccessToken_Handler,
+		},
+		{
+			MethodName: "InvalidateAccessToken",
+			Handler:    _Credentials_InvalidateAccessToken_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "github.com/cube2222/usos-notifier/credentials/credentials.proto",
@@ -147,17 +413,31 @@ func init() {
 }
 
 var fileDescriptor0 = []byte{
-	// 185 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xb2, 0x4f, 0xcf, 0x2c, 0xc9,
-	0x28, 0x4d, 0xd2, 0x4b, 0xce, 0xcf, 0xd5, 0x4f, 0x2e, 0x4d, 0x4a, 0x35, 0x32, 0x32, 0x32, 0xd2,
-	0x2f, 0x2d, 0xce, 0x2f, 0xd6, 0xcd, 0xcb, 0x2f, 0xc9, 0x4c, 0xcb, 0x4c, 0x2d, 0xd2, 0x4f, 0x2e,
-	0x4a, 0x4d, 0x49, 0xcd, 0x2b, 0xc9, 0x4c, 0xcc, 0x29, 0x46, 0x66, 0xeb, 0x15, 0x14, 0xe5, 0x97,
-	0xe4, 0x0b, 0x71, 0x23, 0x09, 0x29, 0x69, 0x73, 0x09, 0xba, 0xa7, 0x96, 0x04, 0xa7, 0x16, 0x17,
-	0x67, 0xe6, 0xe7, 0x05, 0xa5, 0x16, 0x96, 0xa6, 0x16, 0x97, 0x08, 0x89, 0x71, 0xb1, 0x95, 0x16,
-	0xa7, 0x16, 0x65, 0xa6, 0x48, 0x30, 0x2a, 0x30, 0x6a, 0x70, 0x06, 0x41, 0x79, 0x4a, 0x46, 0x5c,
-	0x42, 0xc8, 0x8a, 0x8b, 0x0b, 0xf2, 0xf3, 0x8a, 0x53, 0x85, 0x64, 0xb8, 0x38, 0x8b, 0x21, 0x42,
-	0x70, 0x0d, 0x08, 0x01, 0xa3, 0x18, 0x2e, 0x6e, 0x67, 0x84, 0x7d, 0x42, 0xbe, 0x5c, 0x5c, 0x08,
-	0x23, 0x84, 0xe4, 0xf4, 0x90, 0x9d, 0x87, 0xe1, 0x10, 0x29, 0x79, 0x9c, 0xf2, 0x10, 0xbb, 0x9d,
-	0xf4, 0xa3, 0x74, 0x49, 0x0a, 0x8e, 0x24, 0x36, 0x70, 0x18, 0x18, 0x03, 0x02, 0x00, 0x00, 0xff,
-	0xff, 0xee, 0xbf, 0xc8, 0xb0, 0x46, 0x01, 0x00, 0x00,
+	// 407 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0xed, 0x6e, 0xda, 0x30,
+	0x14, 0x15, 0x30, 0xd0, 0xb8, 0x99, 0xa6, 0x61, 0x0d, 0x94, 0x31, 0x06, 0x9b, 0xa7, 0x4d, 0xfb,
+	0x10, 0x44, 0x4a, 0x1f, 0xa0, 0x6a, 0xfb, 0x03, 0xb5, 0x6a, 0xa5, 0x0a, 0xca, 0x8f, 0xf6, 0x0f,
+	0x4a, 0xc2, 0x6d, 0x6b, 0x35, 0x8d, 0x53, 0xdb, 0xa1, 0xea, 0x33, 0xf4, 0x05, 0xfa, 0xb8, 0x15,
+	0x89, 0xd5, 0x84, 0x40, 0x0a, 0xfd, 0x67, 0x1f, 0x9f, 0xeb, 0x7b, 0xee, 0xf1, 0x91, 0x61, 0xf7,
+	0x8a, 0xa9, 0xeb, 0xc8, 0x1d, 0x78, 0xfc, 0xd6, 0xf2, 0x22, 0x17, 0x6d, 0xdb, 0xb6, 0xad, 0x48,
+	0x72, 0xd9, 0x0f, 0xb8, 0x62, 0x97, 0x0c, 0x85, 0xe5, 0x09, 0x9c, 0x61, 0xa0, 0x98, 0xe3, 0xcb,
+	0xec, 0x7a, 0x10, 0x0a, 0xae, 0x38, 0x31, 0x32, 0x10, 0xfd, 0x0f, 0x8d, 0x21, 0xaa, 0x31, 0x4a,
+	0xc9, 0x78, 0x30, 0xc2, 0xbb, 0x08, 0xa5, 0x22, 0x2d, 0xa8, 0x45, 0x12, 0x05, 0x9b, 0x99, 0xa5,
+	0xef, 0xa5, 0x3f, 0xf5, 0x91, 0xde, 0x51, 0x09, 0x24, 0x4b, 0x96, 0x21, 0x0f, 0x24, 0x92, 0x0e,
+	0xd4, 0x65, 0x02, 0xbd, 0x14, 0xa4, 0x00, 0xe9, 0x02, 0x44, 0x01, 0x9b, 0xa3, 0x90, 0x4c, 0x3d,
+	0x98, 0xe5, 0xf8, 0x38, 0x83, 0x90, 0x1e, 0x18, 0x0b, 0xf1, 0xf7, 0xe8, 0x4e, 0x23, 0xe1, 0x9b,
+	0x15, 0x4d, 0x48, 0xa0, 0x89, 0xf0, 0xe9, 0x29, 0x98, 0x87, 0xc1, 0xdc, 0xf1, 0xd9, 0xcc, 0x51,
+	0xb8, 0x9d, 0xd0, 0x65, 0x49, 0xe5, 0x9c, 0x24, 0xfa, 0x15, 0xbe, 0xac, 0xb9, 0x31, 0x99, 0x86,
+	0x5a, 0xd0, 0x1c, 0xa2, 0xda, 0xf3, 0x3c, 0x94, 0xf2, 0x8c, 0xdf, 0xe0, 0x46, 0x53, 0x9e, 0x4a,
+	0xd0, 0xca, 0x57, 0x68, 0x67, 0x3e, 0x43, 0x55, 0x2d, 0x00, 0x5d, 0x91, 0x6c, 0xc8, 0x0f, 0xf8,
+	0x10, 0x2f, 0xa6, 0x12, 0x3d, 0x81, 0x4a, 0xeb, 0x33, 0x62, 0x6c, 0x1c, 0x43, 0x39, 0xd3, 0xaa,
+	0x45, 0xa6, 0x39, 0x21, 0x8b, 0x4d, 0xab, 0xa5, 0xa6, 0x39, 0x21, 0x9b, 0x08, 0xff, 0xe8, 0xdd,
+	0xfb, 0xca, 0xa7, 0x2a, 0x3d, 0x86, 0x4e, 0x3a, 0xe8, 0xf6, 0x23, 0xa5, 0xba, 0xcb, 0x19, 0xdd,
+	0xb4, 0x07, 0xdf, 0x0a, 0x6e, 0x4b, 0xc6, 0xb5, 0x1f, 0x2b, 0x60, 0x1c, 0xa4, 0xd9, 0x22, 0x27,
+	0x00, 0x69, 0x5c, 0x48, 0x77, 0x90, 0x8d, 0xe2, 0x4a, 0xe8, 0xda, 0xbd, 0xc2, 0x73, 0xed, 0xa6,
+	0x0b, 0x8d, 0x95, 0x67, 0x23, 0xbf, 0x96, 0xaa, 0x8a, 0x82, 0xd2, 0xfe, 0xbd, 0x89, 0xa6, 0x7b,
+	0x9c, 0xc3, 0xc7, 0xe5, 0xb7, 0x24, 0x34, 0x2f, 0x6b, 0xd5, 0xc7, 0xf6, 0xcf, 0x57, 0x39, 0xfa,
+	0xea, 0x00, 0x9a, 0x6b, 0xed, 0x23, 0x7f, 0x0b, 0xb4, 0xad, 0x69, 0xf4, 0x6f, 0x1b, 0x6a, 0xd2,
+	0x6f, 0xdf, 0xba, 0xe8, 0xbf, 0xe9, 0xa7, 0x70, 0x6b, 0xf1, 0xf7, 0xb0, 0xf3, 0x3c, 0x00, 0x3a,
+	0x35, 0xed, 0x22, 0x61, 0x04, 0x00, 0x00,
 }
@@ -0,0 +1,116 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const dataKeySize = 32
+
+type aesGCM struct {
+	version          string
+	keyEncryptionKey cipher.AEAD
+}
+
+// NewAESGCM creates an Encrypter doing envelope encryption with a local AES key of 16, 24 or 32 bytes.
+// Each record is encrypted with its own random data key, which is stored with it, encrypted with the local key.
+// The version distinguishes local keys after rotation.
+func NewAESGCM(version string, key []byte) (Encrypter, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create key encryption cipher")
+	}
+
+	return &aesGCM{
+		version:          version,
+		keyEncryptionKey: aead,
+	}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (a *aesGCM) KeyID() string {
+	return BackendAESGCM + "/" + a.version
+}
+
+// Encrypt returns the encrypted data key length, the encrypted data key and the encrypted plaintext.
+// The encrypted values are prefixed with their nonces.
+func (a *aesGCM) Encrypt(ctx context.Context, plaintext, additionalAuthenticatedData []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, errors.Wrap(err, "couldn't generate data key")
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create data cipher")
+	}
+
+	encryptedKey, err := seal(a.keyEncryptionKey, dataKey, additionalAuthenticatedData)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't encrypt data key")
+	}
+	encryptedData, err := seal(dataAEAD, plaintext, additionalAuthenticatedData)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't encrypt data")
+	}
+
+	out := make([]byte, 2, 2+len(encryptedKey)+len(encryptedData))
+	binary.BigEndian.PutUint16(out, uint16(len(encryptedKey)))
+	out = append(out, encryptedKey...)
+	return append(out, encryptedData...), nil
+}
+
+func (a *aesGCM) Decrypt(ctx context.Context, ciphertext, additionalAuthenticatedData []byte) ([]byte, error) {
+	if len(ciphertext) < 2 {
+		return nil, errors.New("ciphertext too short")
+	}
+	keyLen := int(binary.BigEndian.Uint16(ciphertext))
+	if len(ciphertext) < 2+keyLen {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	dataKey, err := open(a.keyEncryptionKey, ciphertext[2:2+keyLen], additionalAuthenticatedData)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't decrypt data key")
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create data cipher")
+	}
+
+	plaintext, err := open(dataAEAD, ciphertext[2+keyLen:], additionalAuthenticatedData)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't decrypt data")
+	}
+
+	return plaintext, nil
+}
+
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "couldn't generate nonce")
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], additionalData)
+}
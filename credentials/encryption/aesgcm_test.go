@@ -0,0 +1,53 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestAESGCM(t *testing.T) {
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{1}, 32)
+	plaintext := []byte("4-user-8-password")
+	aad := []byte("aad")
+
+	encrypter, err := NewAESGCM("1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := encrypter.Encrypt(ctx, plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := encrypter.Encrypt(ctx, plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, second) {
+		t.Error("expected different ciphertexts for each encryption")
+	}
+
+	decrypted, err := encrypter.Decrypt(ctx, first, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected %s, got %s", plaintext, decrypted)
+	}
+
+	if _, err := encrypter.Decrypt(ctx, first, []byte("other")); err == nil {
+		t.Error("expected error when decrypting with different additional authenticated data")
+	}
+	other, err := NewAESGCM("1", bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Decrypt(ctx, first, aad); err == nil {
+		t.Error("expected error when decrypting with a different key")
+	}
+	if _, err := encrypter.Decrypt(ctx, first[:10], aad); err == nil {
+		t.Error("expected error when decrypting truncated ciphertext")
+	}
+}
@@ -0,0 +1,89 @@
+package encryption
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// Config selects the encryption backend and its keys, meant to be embedded in service configs.
+type Config struct {
+	// Backend is kms, aesgcm or none. The kms backend uses the Cloud KMS key given to Keyring.
+	// The aesgcm backend uses the base64 encoded Key, or the one in KeyFile.
+	// The none backend is meant for local development only.
+	Backend    string `default:"kms" split_words:"true"`
+	Key        string `split_words:"true"`
+	KeyFile    string `split_words:"true"`
+	KeyVersion string `default:"1" split_words:"true"`
+
+	// Previous keys are only used for decryption, until everything is re-encrypted with the current key.
+	// PreviousKeys are base64 encoded aesgcm keys by version, PreviousKeyIDs are Cloud KMS keys.
+	PreviousKeys   map[string]string `split_words:"true"`
+	PreviousKeyIDs []string          `split_words:"true"`
+
+	// LegacyKeyID is the Cloud KMS key of ciphertexts saved before key rotation was supported.
+	LegacyKeyID string `default:"projects/usos-notifier/locations/global/keyRings/credentials/cryptoKeys/credentials" split_words:"true"`
+}
+
+// Keyring creates the keyring described by the config, kmsKeyID is the current key of the kms backend.
+func (c Config) Keyring(ctx context.Context, kmsKeyID string) (*Keyring, error) {
+	var kms *cloudkms.Service
+	kmsKey := func(keyID string) (Encrypter, error) {
+		if kms == nil {
+			httpCli, err := google.DefaultClient(ctx, cloudkms.CloudPlatformScope)
+			if err != nil {
+				return nil, errors.Wrap(err, "couldn't setup google default http client")
+			}
+			kms, err = cloudkms.New(httpCli)
+			if err != nil {
+				return nil, errors.Wrap(err, "couldn't create cloud kms client")
+			}
+		}
+		return NewKMS(kms, keyID), nil
+	}
+
+	var primary Encrypter
+	var err error
+	switch c.Backend {
+	case BackendKMS:
+		primary, err = kmsKey(kmsKeyID)
+	case BackendAESGCM:
+		var key []byte
+		key, err = LoadKey(c.Key, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't load encryption key")
+		}
+		primary, err = NewAESGCM(c.KeyVersion, key)
+	case BackendNone:
+		primary = NewNoop()
+	default:
+		return nil, errors.Errorf("unknown encryption backend %v", c.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []Encrypter
+	for version, encoded := range c.PreviousKeys {
+		key, err := LoadKey(encoded, "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't load previous encryption key %v", version)
+		}
+		encrypter, err := NewAESGCM(version, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't create previous encryption key %v", version)
+		}
+		previous = append(previous, encrypter)
+	}
+	for _, keyID := range c.PreviousKeyIDs {
+		encrypter, err := kmsKey(keyID)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, encrypter)
+	}
+
+	return NewKeyring(primary, previous...).WithLegacyKeyID(c.LegacyKeyID), nil
+}
@@ -0,0 +1,65 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Encrypter encrypts stored credentials.
+// The additional authenticated data has to be the same for encryption and decryption.
+type Encrypter interface {
+	// KeyID identifies the key, it's saved with the ciphertext so the key can be found after rotation.
+	KeyID() string
+	Encrypt(ctx context.Context, plaintext, additionalAuthenticatedData []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext, additionalAuthenticatedData []byte) ([]byte, error)
+}
+
+const (
+	BackendKMS    = "kms"
+	BackendAESGCM = "aesgcm"
+	BackendNone   = "none"
+)
+
+type noop struct{}
+
+// NewNoop creates an Encrypter which stores credentials in plaintext. It's meant for local development only.
+func NewNoop() Encrypter {
+	return noop{}
+}
+
+func (noop) KeyID() string {
+	return BackendNone
+}
+
+func (noop) Encrypt(ctx context.Context, plaintext, additionalAuthenticatedData []byte) ([]byte, error) {
+	return plaintext, nil
+}
+
+func (noop) Decrypt(ctx context.Context, ciphertext, additionalAuthenticatedData []byte) ([]byte, error) {
+	return ciphertext, nil
+}
+
+// LoadKey loads a base64 encoded key, given directly or read from the file at path if the key is empty.
+func LoadKey(key, path string) ([]byte, error) {
+	if key == "" {
+		if path == "" {
+			return nil, errors.New("neither key nor key file provided")
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't read key file")
+		}
+		key = strings.TrimSpace(string(data))
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't base64 decode key")
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,98 @@
+package encryption
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// Keyring encrypts using the primary key and decrypts using any of its keys,
+// so previous keys can still be used until everything is re-encrypted with the primary one.
+type Keyring struct {
+	primary     Encrypter
+	keys        map[string]Encrypter
+	legacyKeyID string
+}
+
+func NewKeyring(primary Encrypter, previous ...Encrypter) *Keyring {
+	keys := map[string]Encrypter{
+		primary.KeyID(): primary,
+	}
+	for _, encrypter := range previous {
+		keys[encrypter.KeyID()] = encrypter
+	}
+
+	return &Keyring{
+		primary: primary,
+		keys:    keys,
+	}
+}
+
+// WithLegacyKeyID sets the key used to decrypt ciphertexts saved without a key ID,
+// from before key rotation was supported.
+func (k *Keyring) WithLegacyKeyID(keyID string) *Keyring {
+	k.legacyKeyID = keyID
+	return k
+}
+
+func (k *Keyring) PrimaryKeyID() string {
+	return k.primary.KeyID()
+}
+
+// Encrypt encrypts using the primary key, returning its ID along with the ciphertext.
+func (k *Keyring) Encrypt(ctx context.Context, plaintext, additionalAuthenticatedData []byte) (string, []byte, error) {
+	ciphertext, err := k.primary.Encrypt(ctx, plaintext, additionalAuthenticatedData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return k.primary.KeyID(), ciphertext, nil
+}
+
+// Decrypt decrypts using the key with the given ID.
+func (k *Keyring) Decrypt(ctx context.Context, keyID string, ciphertext, additionalAuthenticatedData []byte) ([]byte, error) {
+	if keyID == "" {
+		keyID = k.legacyKeyID
+	}
+	encrypter, ok := k.keys[keyID]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownKey, "key %v", keyID)
+	}
+
+	return encrypter.Decrypt(ctx, ciphertext, additionalAuthenticatedData)
+}
+
+// AdditionalData holds the versions of the additional authenticated data, so it can be rotated as well.
+type AdditionalData struct {
+	currentVersion string
+	versions       map[string][]byte
+}
+
+func NewAdditionalData(currentVersion, current string, previous map[string]string) *AdditionalData {
+	versions := map[string][]byte{
+		currentVersion: []byte(current),
+	}
+	for version, data := range previous {
+		versions[version] = []byte(data)
+	}
+
+	return &AdditionalData{
+		currentVersion: currentVersion,
+		versions:       versions,
+	}
+}
+
+func (a *AdditionalData) Current() (string, []byte) {
+	return a.currentVersion, a.versions[a.currentVersion]
+}
+
+func (a *AdditionalData) Get(version string) ([]byte, error) {
+	data, ok := a.versions[version]
+	if !ok {
+		return nil, errors.Errorf("unknown additional authenticated data version %v", version)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,60 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestKeyring(t *testing.T) {
+	ctx := context.Background()
+	plaintext := []byte("4-user-8-password")
+	aad := []byte("aad")
+
+	oldKey, err := NewAESGCM("1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := NewAESGCM("2", bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldKeyID, oldCiphertext, err := NewKeyring(oldKey).Encrypt(ctx, plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := NewKeyring(newKey, oldKey).WithLegacyKeyID(oldKey.KeyID())
+	keyID, ciphertext, err := keyring.Encrypt(ctx, plaintext, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != "aesgcm/2" || keyID != keyring.PrimaryKeyID() {
+		t.Errorf("expected the primary key to be used, got %v", keyID)
+	}
+
+	for _, c := range []struct {
+		keyID      string
+		ciphertext []byte
+	}{
+		{keyID, ciphertext},
+		{oldKeyID, oldCiphertext},
+		// Ciphertexts without a key ID use the legacy key.
+		{"", oldCiphertext},
+	} {
+		decrypted, err := keyring.Decrypt(ctx, c.keyID, c.ciphertext, aad)
+		if err != nil {
+			t.Fatalf("key %q: %v", c.keyID, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("key %q: expected %s, got %s", c.keyID, plaintext, decrypted)
+		}
+	}
+
+	if _, err := NewKeyring(newKey).Decrypt(ctx, oldKeyID, oldCiphertext, aad); errors.Cause(err) != ErrUnknownKey {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package encryption
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/cloudkms/v1"
+)
+
+type kms struct {
+	kms   *cloudkms.Service
+	keyID string
+}
+
+// NewKMS creates an Encrypter using the Cloud KMS key with the given resource ID.
+func NewKMS(service *cloudkms.Service, keyID string) Encrypter {
+	return &kms{
+		kms:   service,
+		keyID: keyID,
+	}
+}
+
+func (k *kms) KeyID() string {
+	return k.keyID
+}
+
+func (k *kms) Encrypt(ctx context.Context, plaintext, additionalAuthenticatedData []byte) ([]byte, error) {
+	encryptRequest := cloudkms.EncryptRequest{
+		AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(additionalAuthenticatedData),
+		Plaintext:                   base64.StdEncoding.EncodeToString(plaintext),
+	}
+
+	res, err := k.kms.Projects.Locations.KeyRings.CryptoKeys.
+		Encrypt(k.keyID, &encryptRequest).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't encrypt using kms")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(res.Ciphertext)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't base64 decode ciphertext")
+	}
+
+	return ciphertext, nil
+}
+
+func (k *kms) Decrypt(ctx context.Context, ciphertext, additionalAuthenticatedData []byte) ([]byte, error) {
+	decryptRequest := cloudkms.DecryptRequest{
+		AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(additionalAuthenticatedData),
+		Ciphertext:                  base64.StdEncoding.EncodeToString(ciphertext),
+	}
+
+	res, err := k.kms.Projects.Locations.KeyRings.CryptoKeys.
+		Decrypt(k.keyID, &decryptRequest).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't decrypt using kms")
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(res.Plaintext)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't base64 decode plaintext")
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,63 @@
+package credentials
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Reasons for failing to log into USOS. GetSession returns them as gRPC status codes,
+// use LoginErrorFromStatus to get them back.
+var (
+	// ErrInvalidPassword means the stored credentials don't work anymore, the user has to authorize again.
+	ErrInvalidPassword = errors.New("invalid username or password")
+	// ErrAccountLocked means the user has to unlock their account, authorizing again won't help until then.
+	ErrAccountLocked = errors.New("account locked")
+	// ErrCASUnavailable means CAS or USOSweb couldn't be reached or failed, retrying later should help.
+	ErrCASUnavailable = errors.New("CAS unavailable")
+	// ErrPageFormatChanged means the login pages changed and the login has to be fixed, retrying won't help.
+	ErrPageFormatChanged = errors.New("login page format changed")
+	// ErrSessionCookieMissing means the login seemed successful, but USOSweb didn't set a session cookie.
+	ErrSessionCookieMissing = errors.New("session cookie missing")
+)
+
+var loginErrorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{ErrInvalidPassword, codes.Unauthenticated},
+	{ErrAccountLocked, codes.PermissionDenied},
+	{ErrCASUnavailable, codes.Unavailable},
+	// gRPC itself returns INTERNAL for some transport errors, which are worth retrying.
+	{ErrPageFormatChanged, codes.FailedPrecondition},
+	{ErrSessionCookieMissing, codes.Aborted},
+}
+
+// LoginErrorStatus returns a gRPC status error with the code of the login error, other errors are returned as is.
+func LoginErrorStatus(err error) error {
+	cause := errors.Cause(err)
+	for _, c := range loginErrorCodes {
+		if cause == c.err {
+			return status.Error(c.code, err.Error())
+		}
+	}
+
+	return err
+}
+
+// LoginErrorFromStatus returns the login error corresponding to the gRPC status code, wrapped with the status message.
+// Other errors are returned as is. Failing to reach the credentials service is reported as ErrCASUnavailable too,
+// which is fine, as both are worth retrying.
+func LoginErrorFromStatus(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, c := range loginErrorCodes {
+		if s.Code() == c.code {
+			return errors.Wrap(c.err, s.Message())
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,31 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginErrorStatus(t *testing.T) {
+	for _, loginErr := range []error{ErrInvalidPassword, ErrAccountLocked, ErrCASUnavailable, ErrPageFormatChanged, ErrSessionCookieMissing} {
+		err := LoginErrorStatus(errors.Wrap(loginErr, "couldn't login"))
+		if _, ok := status.FromError(err); !ok {
+			t.Errorf("%v: expected a status error, got %v", loginErr, err)
+		}
+		if got := errors.Cause(LoginErrorFromStatus(err)); got != loginErr {
+			t.Errorf("%v: got %v back from the status", loginErr, got)
+		}
+	}
+
+	other := errors.New("other")
+	if err := LoginErrorStatus(other); err != other {
+		t.Errorf("expected other errors as is, got %v", err)
+	}
+	for _, code := range []codes.Code{codes.NotFound, codes.Internal} {
+		if err := LoginErrorFromStatus(status.Error(code, "other")); status.Code(err) != code {
+			t.Errorf("expected other status errors as is, got %v", err)
+		}
+	}
+}
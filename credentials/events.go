@@ -0,0 +1,45 @@
+package credentials
+
+import (
+	"github.com/cube2222/usos-notifier/common/events"
+	"github.com/cube2222/usos-notifier/common/users"
+)
+
+const CredentialsReceivedEventName = "credentials_received"
+
+type CredentialsReceivedEvent struct {
+	UserID users.UserID `json:"user_id"`
+}
+
+const CredentialsInvalidatedEventName = "credentials_invalidated"
+
+// CredentialsInvalidatedEvent is published when the stored credentials of a user stop working,
+// checks should be paused until new credentials are received.
+type CredentialsInvalidatedEvent struct {
+	UserID users.UserID `json:"user_id"`
+}
+
+func init() {
+	events.Register(&events.Schema{
+		Name:    CredentialsReceivedEventName,
+		Version: 1,
+		Codec:   events.JSON,
+		New: func() interface{} {
+			return &CredentialsReceivedEvent{}
+		},
+		DecodeLegacy: func(data []byte, attributes map[string]string) (interface{}, error) {
+			// This used to be the bare user ID.
+			return &CredentialsReceivedEvent{
+				UserID: users.NewUserID(string(data)),
+			}, nil
+		},
+	})
+	events.Register(&events.Schema{
+		Name:    CredentialsInvalidatedEventName,
+		Version: 1,
+		Codec:   events.JSON,
+		New: func() interface{} {
+			return &CredentialsInvalidatedEvent{}
+		},
+	})
+}
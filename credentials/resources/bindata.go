@@ -68,7 +68,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var _authorizeHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xb4\x95\x4d\x6f\xe3\x36\x10\x86\xef\xfa\x15\x5c\x5e\x0b\x99\x6e\xe3\x0d\x8c\x82\x12\xe0\xb6\xeb\xed\x2e\xd0\xd4\x6d\x5c\xc4\x3d\xd2\xe2\x58\x62\xc2\x0f\x95\x1c\x39\x56\x0c\x5d\xfa\xdf\xfa\xbf\x0a\x7d\xc5\x1f\xa7\x14\x48\x7d\xb0\xfd\x0e\x07\xef\x3b\xf3\x08\xa0\xf8\x87\x9f\x7e\xfd\x71\xfd\xe7\xea\x13\x29\xd0\xe8\x34\xe2\xed\x0f\xd1\xc2\xe6\x09\x05\x4b\xdb\x02\x08\x99\x46\x84\x10\xc2\xb5\xb2\x4f\xc4\x83\x4e\x68\xc0\x5a\x43\x28\x00\x90\x92\xc2\xc3\x2e\xa1\x05\x62\x19\xbe\x67\xcc\x88\x43\x26\xed\x64\xeb\x1c\x06\xf4\xa2\x6c\x45\xe6\x0c\x7b\x2d\xb0\xd9\x64\x3a\x99\xb2\x2c\x84\x53\x6d\x62\x94\x9d\x64\x21\xd0\x2e\xa7\xff\x28\x8b\x90\x7b\x85\x75\x42\x43\x21\x6e\xe6\xb3\xf8\xb3\xfd\x78\x33\x9f\x1d\xfe\xfa\xed\x5b\xe1\x1e\x36\x8b\x6f\xa6\x1f\xe7\xbf\x6f\x56\x87\x55\x7e\xbb\xab\x67\x5f\x1e\xf6\xeb\xbb\x62\xfa\xe9\xbb\xdb\x9b\x8d\x59\x66\x5f\xf5\xfd\xe2\x59\x7d\xce\x97\x8b\x07\x26\x17\xea\xfe\xf6\xeb\xc6\x50\x92\x79\x17\x82\xf3\x2a\x57\x36\xa1\xc2\x3a\x5b\x1b\x57\x05\x3a\xac\x67\x00\x05\xc9\x0a\xe1\x03\x60\x42\xff\x58\x2f\xe3\xf9\x78\x84\x0a\x35\xa4\xf7\x2a\xb7\x55\xc9\x59\xaf\x22\xce\x7a\x36\x7c\xeb\x64\x9d\x46\x7c\xe7\xbc\x21\x99\x16\x21\x24\xb4\xfd\x1f\x17\xce\xab\x17\x67\x51\x68\x4a\x44\x86\xca\xd9\x84\xb2\xcc\x83\x04\x8b\x4a\xe8\xc0\x44\x85\x5d\x0f\x50\x62\x00\x0b\x27\x13\x5a\xba\x80\x63\xea\x4e\x81\x96\x01\x30\x8d\x5e\xb9\xf0\x0f\x71\x4c\x96\x6d\xd0\x9d\x30\x40\xe2\x38\x3d\x1d\x69\xc8\xc1\xca\x74\x51\xa1\xf3\xf5\x8b\xc8\x1e\x05\x67\x43\xed\x64\x70\x3c\xaa\x1d\x99\xfc\x02\x21\x88\x1c\x56\x1e\x02\x58\x6c\x9a\x33\xee\x84\xf0\x72\xdc\x42\x83\x90\x34\x3d\x1e\xc7\xfe\xa6\xe1\xac\x4c\xcf\xbc\xc0\xca\xa6\x89\xae\xc6\x5b\xc3\x01\x89\xb2\x65\x85\x17\xe3\x49\xb5\xbf\xa0\x93\x7b\x57\x95\x34\xbd\x8c\xd6\x62\x0b\x7a\x6c\xcb\x9c\x8e\x8d\x8c\x67\x24\x73\x16\xbd\xd3\x71\x77\x4a\xc9\xce\xf9\x84\x22\x1c\xb0\x0b\xa1\xe9\x97\x16\x68\xbd\x53\x4f\x02\x9d\xe7\xac\xeb\xba\xf2\x3d\x0b\x1f\x5d\xaf\xa2\xbb\xb6\xce\x90\x28\x99\xd0\x2a\x80\xb7\xc2\x00\x25\xed\xf7\xb9\xc6\xba\x84\x3e\x9e\x92\x52\x8b\x0c\x0a\xa7\x25\xf8\x84\x5e\x8c\x41\x2f\x76\x1d\x16\x18\xa8\x18\x79\xbd\x36\x93\x6a\x7f\x86\xaa\x97\x97\x54\x57\x22\x84\x67\xe7\xe5\xff\x4f\xb6\x1c\x92\x06\xba\x3f\x8b\xf0\xcf\xdf\xee\x9d\xb0\x8e\xde\x23\xd6\x93\xee\xb1\x9e\xf4\x05\xda\x7e\x86\x77\x65\xda\xcf\xd4\xa7\x16\x4a\x4a\xb0\xe3\x4c\xe8\x9e\x5a\xb1\x17\xba\x82\x84\x1e\x8f\x93\x75\x5b\x68\x1a\xca\xae\x9f\xc9\x0f\x15\xa2\xb3\xe4\xbf\x3f\x8c\x37\x72\xdb\xf6\xfe\x2d\xb8\x50\x6d\x8d\xc2\x71\xc4\x51\x0d\x1e\x5b\xb4\x64\x8b\x36\x2e\xbd\x32\xc2\xd7\x74\xbc\x03\xaa\x47\xce\x7a\x8f\x37\xb3\xe1\xec\x74\xeb\x70\xd6\x6e\x90\x46\x11\x67\xc3\x15\xc7\xba\xb7\xc4\xbf\x01\x00\x00\xff\xff\xb4\xc2\xf7\x46\x35\x06\x00\x00")
+var _authorizeHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xb5\x56\xdd\x6e\xdb\x36\x18\xbd\xcf\x53\xb0\x44\xef\x36\x99\xd9\x9a\x06\xc1\x20\x0b\x70\xd7\xa6\x4b\x81\xb5\x6e\xed\x20\xd9\x25\x2d\x7e\x96\xd8\x50\xa4\x4a\x52\x49\xec\xc0\x37\x7b\xb7\xbe\x57\x3f\x9a\x52\x64\x39\x6d\xb0\x62\xad\x00\x43\xfa\x28\xea\x9c\xc3\x73\xf8\xe3\xf4\xc9\xcb\x77\x7f\xce\xff\x99\xbe\x22\xa5\xaf\x54\x76\x90\x86\x1b\x51\x5c\x17\x63\x0a\x9a\x86\x06\xe0\x22\x3b\x20\x78\xa5\x4a\xea\x2b\x62\x41\x8d\xa9\xf3\x2b\x05\xae\x04\xf0\x94\x94\x16\x96\x63\x5a\x7a\x5f\xbb\x3f\x18\xab\xf8\x6d\x2e\xf4\x68\x61\x8c\x77\xde\xf2\x3a\x14\xb9\xa9\xd8\x7d\x03\x3b\x1a\x1d\x8e\x0e\x59\xee\x5c\xdf\x36\xaa\x24\xf6\x72\x8e\x6e\x79\xe2\x25\xb5\x87\xc2\x4a\xbf\x42\xb6\x92\x3f\x3b\x39\x4a\x5e\xeb\xe7\x78\xbb\xfd\xf4\xfe\x37\x6e\x2e\x2e\x27\xbf\x1c\x3e\x3f\xf9\x70\x39\xbd\x9d\x16\xc7\xcb\xd5\xd1\xd9\xc5\xf5\xfc\x6d\x79\xf8\xea\xf7\xe3\x67\x97\xd5\x69\xfe\x46\xcd\x26\x37\xf2\x75\x71\x3a\xb9\x60\x62\x22\x67\xc7\x6f\x2e\x2b\x4a\x72\x6b\x9c\x33\x56\x16\x52\x8f\x29\xd7\x46\xaf\x2a\xd3\x38\xda\x0e\xaf\x02\xcf\x49\x5e\x72\xeb\xc0\x8f\xe9\xf9\xfc\x34\x39\xe9\x5e\x79\xe9\x15\x64\x33\x59\xe8\xa6\x4e\x59\xac\x0e\x52\x16\xbd\x49\x17\x46\xac\xf0\xb6\x34\xb6\x22\xb9\xe2\xce\x8d\x69\x78\x4e\x4a\xa4\x5a\x1b\xed\xb9\xa2\x84\xe7\x5e\x1a\x64\x65\xb9\x05\x01\xda\x4b\xae\x1c\xe3\x8d\xdf\xf6\x01\x4a\x90\xbc\x34\x62\x4c\x6b\xe3\x7c\xc7\xba\x94\xa0\x04\x8a\xc9\x0e\xee\x7d\x49\x9f\x24\x09\x39\x0d\x44\x6f\x79\x05\x24\x49\xb2\xfe\x95\x82\x02\xb4\xc8\x26\x8d\x37\x76\xb5\xe6\xf9\x47\x9e\xb2\xb6\xad\x07\xb8\xbb\x93\x4b\x32\xfa\x1b\x9c\xe3\x05\x4c\x2d\x38\xd4\xb2\xd9\xec\xf8\x8e\x40\x75\x37\x0a\x85\xe3\xa3\xd9\xdd\x5d\xd7\x7f\xb3\x49\x59\x9d\xed\x60\x21\x36\x7e\xbc\x27\x6f\x06\x0a\x72\x4f\x1a\x2d\xaf\xc1\x3a\x4c\x70\xa0\x52\xc8\xeb\x81\x49\x85\x35\x4d\x4d\xb3\xa1\x02\xc5\x17\xa0\xba\x6e\xb9\x51\x49\x25\x92\x23\x92\xa3\x97\x16\x8b\xed\x5b\x4a\xf0\xf3\x31\xed\x59\x68\x76\x9e\xaf\x41\x69\x19\x86\x1d\x7a\xec\x61\xee\x10\x77\x88\x7b\xb4\xdb\x6e\x2e\xaa\x97\x62\x80\x4d\x34\xda\x3d\x6c\xd9\x1d\x44\xab\xec\x2b\x78\xd1\x27\x8b\x0b\x0a\xc8\xe8\xbc\xfb\x5c\x82\xdb\x33\x7d\xa0\xc1\xd4\x61\xb2\x90\x6b\xae\x1a\x24\x45\xff\xcf\x5e\x6e\x36\x34\x66\x07\x9f\x08\x96\xe4\x69\x0f\xb6\xda\x6c\xa2\x68\x10\x6d\x22\x21\xb2\x30\x3f\x42\x5e\x11\xeb\x5b\xc2\x62\x80\x0f\x04\xb0\x08\xb8\xe7\x20\x43\x0b\x77\x92\x8c\xe5\x30\xfb\x39\xdc\xa2\x77\xba\x6e\xfc\xcf\x0c\xdd\x23\xcb\x96\x84\x66\x67\x61\x31\xad\x96\xf2\x8a\xe3\xac\xff\x5f\xc1\x6f\x01\x63\xee\x0e\x6c\xc8\xfb\x3e\xf5\xfb\xda\xaf\x6a\x88\xf4\x94\xd4\x8a\xe7\x50\x1a\x25\x00\x15\x0d\x64\x7c\x75\x6e\xb4\xae\x54\x82\x7e\xbf\xab\x53\x44\xbb\x31\x56\xfc\x7c\x67\xeb\x96\xa9\x75\xf7\x2f\xee\x3e\xff\x6b\x7e\x90\xad\x1d\x76\x67\x6b\x5f\x47\x5b\xfb\x7a\x60\x6d\xd4\xf0\x43\x3d\x8d\x9a\x22\x6b\x29\x05\x66\xd7\x69\xf2\xe6\x2a\x14\xfd\xca\x9b\x87\x06\x5c\x7c\x6c\x3f\x93\x17\x8d\xf7\xb8\x46\xbf\x3f\x8c\xff\xe8\xdb\x22\xe2\x07\xe3\x5c\xb3\xa8\xa4\xef\x24\x76\x55\x8b\xb1\xf0\x9a\xe0\x2f\xa9\xad\xac\xb8\xc5\x5d\xb0\xdd\xff\x9b\x8f\x29\x8b\x18\x0f\xc1\xe3\x21\x70\x3e\x7b\x37\x9b\x4c\xcf\xbe\xb1\x11\xed\x0a\x68\x9c\x71\xbc\x96\xfd\x7a\x68\xcb\x3d\x09\x0e\x30\x17\x11\x44\x84\xc9\x54\x3d\x7e\xe4\xb1\x80\xb2\xa3\x96\xd4\x76\x0d\x6b\x12\x44\xfd\x4a\x16\xf8\x54\x1b\xc1\x6f\x38\x6e\xe7\xa4\x0c\x33\x80\x3f\x36\x9c\x87\xdb\xd8\x23\x53\x20\x65\xfd\xc1\x8a\xcf\xa8\x14\x5f\x20\x7a\x3c\xc5\xd9\xf6\x8f\xd0\x17\x09\x0b\x0a\x4f\x18\x09\x00\x00")
 
 func authorizeHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -83,7 +83,7 @@ func authorizeHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "authorize.html", size: 1589, mode: os.FileMode(438), modTime: time.Unix(1530367134, 0)}
+	info := bindataFileInfo{name: "authorize.html", size: 2328, mode: os.FileMode(438), modTime: time.Unix(1792310655, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
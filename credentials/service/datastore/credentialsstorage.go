@@ -4,139 +4,311 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"strconv"
-	"strings"
+	"time"
 
+	"github.com/cube2222/usos-notifier/common/events/outbox"
+	outboxdatastore "github.com/cube2222/usos-notifier/common/events/outbox/datastore"
 	"github.com/cube2222/usos-notifier/common/users"
 	"github.com/cube2222/usos-notifier/credentials"
+	"github.com/cube2222/usos-notifier/credentials/encryption"
 
 	"cloud.google.com/go/datastore"
 	"github.com/pkg/errors"
-	"google.golang.org/api/cloudkms/v1"
 )
 
+const credentialsTable = "credentials"
+
+// lastLoginResolution is how much newer a login has to be to get saved, so not every login writes the credentials.
+const lastLoginResolution = time.Hour
+
+// legacyAdditionalDataVersion is the additional authenticated data version of credentials
+// saved before it was recorded.
+const legacyAdditionalDataVersion = "1"
+
 type encrypted struct {
+	// UserAndPassword is the base64 encoded ciphertext.
 	UserAndPassword string
+	// KeyID and AdditionalDataVersion are empty for credentials saved before key rotation was supported.
+	KeyID                 string
+	AdditionalDataVersion string
+	Version               int
+
+	// The login state is saved unencrypted since loginStateRecordVersion, so logins don't re-encrypt the credentials.
+	LastLogin               time.Time `datastore:",noindex"`
+	InvalidPasswordFailures int       `datastore:",noindex"`
+	Stale                   bool      `datastore:",noindex"`
+}
+
+// errLegacyRecord is returned for legacy records once they're rejected, their ciphertext isn't bound to the user.
+var errLegacyRecord = errors.New("legacy credentials record, re-encrypt it")
+
+// cipher encrypts and decrypts the stored credentials, it's shared with the re-encryption job.
+type cipher struct {
+	keyring        *encryption.Keyring
+	additionalData *encryption.AdditionalData
+	// rejectLegacy refuses to decrypt legacy records, once the re-encryption job has migrated them all.
+	rejectLegacy bool
+}
+
+func (c *cipher) encrypt(ctx context.Context, userID users.UserID, plaintext []byte) (*encrypted, error) {
+	version, additionalData := c.additionalData.Current()
+	additionalData = recordAdditionalData(additionalData, userID, currentRecordVersion)
+	keyID, ciphertext, err := c.keyring.Encrypt(ctx, plaintext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encrypted{
+		UserAndPassword:       base64.StdEncoding.EncodeToString(ciphertext),
+		KeyID:                 keyID,
+		AdditionalDataVersion: version,
+		Version:               currentRecordVersion,
+	}, nil
+}
+
+func (c *cipher) decrypt(ctx context.Context, userID users.UserID, encrypted *encrypted) ([]byte, error) {
+	if c.rejectLegacy && encrypted.Version == legacyRecordVersion {
+		return nil, errLegacyRecord
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted.UserAndPassword)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't base64 decode ciphertext")
+	}
+
+	version := encrypted.AdditionalDataVersion
+	if version == "" {
+		version = legacyAdditionalDataVersion
+	}
+	additionalData, err := c.additionalData.Get(version)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted.Version != legacyRecordVersion {
+		additionalData = recordAdditionalData(additionalData, userID, encrypted.Version)
+	}
+
+	return c.keyring.Decrypt(ctx, encrypted.KeyID, ciphertext, additionalData)
+}
+
+// isCurrent checks if the credentials are encrypted with the current key, additional authenticated data and record version.
+func (c *cipher) isCurrent(encrypted *encrypted) bool {
+	version, _ := c.additionalData.Current()
+	return encrypted.KeyID == c.keyring.PrimaryKeyID() &&
+		encrypted.AdditionalDataVersion == version &&
+		encrypted.Version == currentRecordVersion
+}
+
+// recordAdditionalData binds the additional authenticated data to the user and the record version,
+// so a ciphertext copied to another user's credentials can't be decrypted.
+func recordAdditionalData(additionalData []byte, userID users.UserID, recordVersion int) []byte {
+	return []byte(fmt.Sprintf("%d-%s-%d-%s-%d", len(additionalData), additionalData, len(userID), userID, recordVersion))
 }
 
 type credentialsStorage struct {
-	additionalAuthenticatedData []byte
-	encryptionKeyID             string
-	ds                          *datastore.Client
-	kms                         *cloudkms.Service
+	cipher *cipher
+	ds     *datastore.Client
 }
 
-func NewCredentialsStorage(ds *datastore.Client, kms *cloudkms.Service, encryptionKeyID, additionalAuthenticatedData string) credentials.CredentialsStorage {
+// NewCredentialsStorage creates a CredentialsStorage backed by Datastore, rejectLegacy refuses legacy records.
+func NewCredentialsStorage(ds *datastore.Client, keyring *encryption.Keyring, additionalData *encryption.AdditionalData, rejectLegacy bool) credentials.CredentialsStorage {
 	return &credentialsStorage{
-		additionalAuthenticatedData: []byte(additionalAuthenticatedData),
-		encryptionKeyID:             encryptionKeyID,
-		ds:                          ds,
-		kms:                         kms,
+		cipher: &cipher{
+			keyring:        keyring,
+			additionalData: additionalData,
+			rejectLegacy:   rejectLegacy,
+		},
+		ds: ds,
 	}
 }
 
 func (cs *credentialsStorage) GetCredentials(ctx context.Context, userID users.UserID) (*credentials.Credentials, error) {
-	key := datastore.NameKey("credentials", userID.String(), nil)
+	key := datastore.NameKey(credentialsTable, userID.String(), nil)
 
 	encrypted := encrypted{}
 
 	err := cs.ds.Get(ctx, key, &encrypted)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, credentials.ErrCredentialsNotFound
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't get encrypted credentials")
 	}
 
-	decryptRequest := cloudkms.DecryptRequest{
-		AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(cs.additionalAuthenticatedData),
-		Ciphertext:                  encrypted.UserAndPassword,
-	}
+	return cs.decode(ctx, userID, &encrypted)
+}
 
-	res, err := cs.kms.Projects.Locations.KeyRings.CryptoKeys.
-		Decrypt(cs.encryptionKeyID, &decryptRequest).
-		Context(ctx).
-		Do()
+func (cs *credentialsStorage) decode(ctx context.Context, userID users.UserID, encrypted *encrypted) (*credentials.Credentials, error) {
+	decrypted, err := cs.cipher.decrypt(ctx, userID, encrypted)
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't decrypt credentials")
 	}
 
-	decrypted, err := base64.StdEncoding.DecodeString(res.Plaintext)
-	if err != nil {
-		return nil, errors.Wrap(err, "couldn't base64 decode credentials")
-	}
-
-	creds, err := decodeUserAndPassword(string(decrypted))
+	creds, err := decodeRecord(encrypted.Version, decrypted)
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't decode credentials")
 	}
+	if encrypted.Version >= loginStateRecordVersion {
+		creds.LastLogin = encrypted.LastLogin
+		creds.InvalidPasswordFailures = encrypted.InvalidPasswordFailures
+		creds.Stale = encrypted.Stale
+	}
 
 	return creds, nil
 }
 
-func decodeUserAndPassword(encoded string) (*credentials.Credentials, error) {
-	i := strings.Index(encoded, "-")
-	if i == -1 {
-		return nil, errors.New("missing username length")
-	}
-	usernameLen, err := strconv.Atoi(encoded[:i])
+func (cs *credentialsStorage) encode(ctx context.Context, userID users.UserID, creds *credentials.Credentials) (*encrypted, error) {
+	data, err := encodeRecord(creds)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid username length")
+		return nil, errors.Wrap(err, "couldn't encode credentials")
 	}
 
-	usernameBegin := i + 1
-	usernameEnd := usernameBegin + usernameLen
-
-	// +1 because of the dash after the username
-	if len(encoded) <= usernameEnd+1 {
-		return nil, errors.New("missing part of encoded username value")
+	encrypted, err := cs.cipher.encrypt(ctx, userID, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't encrypt credentials")
 	}
+	encrypted.LastLogin = creds.LastLogin
+	encrypted.InvalidPasswordFailures = creds.InvalidPasswordFailures
+	encrypted.Stale = creds.Stale
 
-	passwordPart := encoded[usernameEnd+1:]
+	return encrypted, nil
+}
 
-	i = strings.Index(passwordPart, "-")
-	if i == -1 {
-		return nil, errors.New("missing password length")
+// withLoginState returns the stored credentials with their login state saved unencrypted,
+// records older than loginStateRecordVersion are re-encrypted once to move it out of the ciphertext.
+func (cs *credentialsStorage) withLoginState(ctx context.Context, userID users.UserID, existing *encrypted) (*encrypted, error) {
+	if existing.Version >= loginStateRecordVersion {
+		return existing, nil
 	}
-	passwordLen, err := strconv.Atoi(passwordPart[:i])
+
+	creds, err := cs.decode(ctx, userID, existing)
 	if err != nil {
-		return nil, errors.Wrap(err, "invalid password length")
+		return nil, err
 	}
 
-	passwordBegin := i + 1
-	passwordEnd := passwordBegin + passwordLen
+	return cs.encode(ctx, userID, creds)
+}
 
-	if len(encoded) <= passwordEnd {
-		return nil, errors.New("missing part of encoded password value")
+func (cs *credentialsStorage) SaveCredentials(ctx context.Context, userID users.UserID, creds *credentials.Credentials, events ...*outbox.Event) error {
+	tx, err := cs.ds.NewTransaction(ctx)
+	if err != nil {
+		return errors.Wrap(err, "couldn't begin transaction")
 	}
+	defer tx.Rollback()
 
-	return &credentials.Credentials{
-		User:     encoded[usernameBegin:usernameEnd],
-		Password: passwordPart[passwordBegin:passwordEnd],
-	}, nil
-}
+	key := datastore.NameKey(credentialsTable, userID.String(), nil)
 
-func (cs *credentialsStorage) SaveCredentials(ctx context.Context, userID users.UserID, user, password string) error {
-	credsPhrase := encodeUserAndPassword(user, password)
+	now := time.Now()
+	record := *creds
+	record.CreatedAt = now
+	record.UpdatedAt = now
 
-	encryptRequest := cloudkms.EncryptRequest{
-		AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(cs.additionalAuthenticatedData),
-		Plaintext:                   base64.StdEncoding.EncodeToString([]byte(credsPhrase)),
+	existing := encrypted{}
+	err = tx.Get(key, &existing)
+	switch {
+	case err == nil:
+		// The previous credentials may not be readable anymore, in which case they're just replaced.
+		if previous, err := cs.decode(ctx, userID, &existing); err == nil && !previous.CreatedAt.IsZero() {
+			record.CreatedAt = previous.CreatedAt
+		}
+	case err != datastore.ErrNoSuchEntity:
+		return errors.Wrap(err, "couldn't get existing credentials")
 	}
-	res, err := cs.kms.Projects.Locations.KeyRings.CryptoKeys.Encrypt(cs.encryptionKeyID, &encryptRequest).Do()
+
+	encrypted, err := cs.encode(ctx, userID, &record)
 	if err != nil {
-		return errors.Wrap(err, "couldn't encrypt credentials")
+		return err
 	}
 
-	key := datastore.NameKey("credentials", userID.String(), nil)
-
-	key, err = cs.ds.Put(ctx, key, &encrypted{
-		UserAndPassword: res.Ciphertext,
-	})
+	_, err = tx.Put(key, encrypted)
 	if err != nil {
 		return errors.Wrap(err, "couldn't save credentials")
 	}
+	err = outboxdatastore.Add(tx, events...)
+	if err != nil {
+		return errors.Wrap(err, "couldn't add events to outbox")
+	}
+
+	_, err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "couldn't commit transaction")
+	}
 
 	return nil
 }
 
-func encodeUserAndPassword(user, password string) string {
-	return fmt.Sprintf("%d-%s-%d-%s", len(user), user, len(password), password)
+func (cs *credentialsStorage) SetLastLogin(ctx context.Context, userID users.UserID, lastLogin time.Time) error {
+	key := datastore.NameKey(credentialsTable, userID.String(), nil)
+
+	_, err := cs.ds.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		existing := encrypted{}
+		err := tx.Get(key, &existing)
+		if err != nil {
+			return errors.Wrap(err, "couldn't get encrypted credentials")
+		}
+
+		migrated := existing.Version < loginStateRecordVersion
+		stored, err := cs.withLoginState(ctx, userID, &existing)
+		if err != nil {
+			return err
+		}
+		if !migrated && !lastLogin.After(stored.LastLogin.Add(lastLoginResolution)) && stored.InvalidPasswordFailures == 0 {
+			return nil
+		}
+		if lastLogin.After(stored.LastLogin) {
+			stored.LastLogin = lastLogin
+		}
+		stored.InvalidPasswordFailures = 0
+
+		_, err = tx.Put(key, stored)
+		if err != nil {
+			return errors.Wrap(err, "couldn't save credentials")
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func (cs *credentialsStorage) RecordInvalidPassword(ctx context.Context, userID users.UserID, maxFailures int, events ...*outbox.Event) (bool, error) {
+	key := datastore.NameKey(credentialsTable, userID.String(), nil)
+
+	markedStale := false
+	_, err := cs.ds.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		markedStale = false
+
+		existing := encrypted{}
+		err := tx.Get(key, &existing)
+		if err != nil {
+			return errors.Wrap(err, "couldn't get encrypted credentials")
+		}
+
+		stored, err := cs.withLoginState(ctx, userID, &existing)
+		if err != nil {
+			return err
+		}
+		if stored.Stale {
+			return nil
+		}
+		stored.InvalidPasswordFailures++
+		if stored.InvalidPasswordFailures >= maxFailures {
+			stored.Stale = true
+			markedStale = true
+		}
+
+		_, err = tx.Put(key, stored)
+		if err != nil {
+			return errors.Wrap(err, "couldn't save credentials")
+		}
+		if markedStale {
+			err = outboxdatastore.Add(tx, events...)
+			if err != nil {
+				return errors.Wrap(err, "couldn't add events to outbox")
+			}
+		}
+
+		return nil
+	})
+
+	return markedStale, err
 }
@@ -0,0 +1,257 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+
+	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/credentials"
+	"github.com/cube2222/usos-notifier/credentials/encryption"
+)
+
+func newTestCipher(t *testing.T) *cipher {
+	key, err := encryption.NewAESGCM("1", bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &cipher{
+		keyring:        encryption.NewKeyring(key),
+		additionalData: encryption.NewAdditionalData("1", "something", nil),
+	}
+}
+
+func TestCipher_SwappedCiphertext(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCipher(t)
+
+	alice, err := c.encrypt(ctx, users.NewUserID("alice"), []byte(`{"user":"alice","password":"secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.isCurrent(alice) {
+		t.Error("expected freshly encrypted credentials to be current")
+	}
+
+	if _, err := c.decrypt(ctx, users.NewUserID("alice"), alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.decrypt(ctx, users.NewUserID("bob"), alice); err == nil {
+		t.Error("expected ciphertext of another user to be rejected")
+	}
+
+	// Legacy records aren't bound to the user, they're re-encrypted by the migration.
+	legacy := *alice
+	legacy.Version = 0
+	if c.isCurrent(&legacy) {
+		t.Error("expected legacy record not to be current")
+	}
+}
+
+func TestCipher_RejectLegacy(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCipher(t)
+
+	// Legacy records are encrypted with the shared additional authenticated data.
+	_, additionalData := c.additionalData.Current()
+	keyID, ciphertext, err := c.keyring.Encrypt(ctx, []byte("5-alice-6-secret"), additionalData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := &encrypted{
+		UserAndPassword: base64.StdEncoding.EncodeToString(ciphertext),
+		KeyID:           keyID,
+		Version:         legacyRecordVersion,
+	}
+
+	if _, err := c.decrypt(ctx, users.NewUserID("alice"), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	c.rejectLegacy = true
+	if _, err := c.decrypt(ctx, users.NewUserID("alice"), legacy); err != errLegacyRecord {
+		t.Errorf("expected legacy record to be rejected, got %v", err)
+	}
+}
+
+func TestCredentialsStorage_LoginState(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCipher(t)
+	cs := &credentialsStorage{cipher: c}
+	userID := users.NewUserID("alice")
+	lastLogin := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	// Records older than loginStateRecordVersion hold the login state in the ciphertext.
+	version, additionalData := c.additionalData.Current()
+	keyID, ciphertext, err := c.keyring.Encrypt(ctx,
+		[]byte(`{"user":"alice","password":"secret","last_login":"2026-10-18T12:00:00Z","invalid_password_failures":2}`),
+		recordAdditionalData(additionalData, userID, jsonRecordVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := &encrypted{
+		UserAndPassword:       base64.StdEncoding.EncodeToString(ciphertext),
+		KeyID:                 keyID,
+		AdditionalDataVersion: version,
+		Version:               jsonRecordVersion,
+	}
+
+	migrated, err := cs.withLoginState(ctx, userID, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated.Version != loginStateRecordVersion || !migrated.LastLogin.Equal(lastLogin) || migrated.InvalidPasswordFailures != 2 {
+		t.Errorf("expected the login state to be moved out of the ciphertext, got %+v", migrated)
+	}
+	plaintext, err := c.decrypt(ctx, userID, migrated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(plaintext, []byte("invalid_password_failures")) {
+		t.Errorf("expected the login state not to be encrypted, got %s", plaintext)
+	}
+
+	// The login state of current records is updated without decrypting them.
+	if current, err := cs.withLoginState(ctx, userID, migrated); err != nil || current != migrated {
+		t.Errorf("expected current record to be returned as is, got %+v, %v", current, err)
+	}
+	migrated.InvalidPasswordFailures = 0
+	migrated.Stale = true
+	creds, err := cs.decode(ctx, userID, migrated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.User != "alice" || creds.Password != "secret" || !creds.LastLogin.Equal(lastLogin) || creds.InvalidPasswordFailures != 0 || !creds.Stale {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+}
+
+// TestCredentialsStorage_SwappedCiphertext needs the Datastore emulator, see gcloud beta emulators datastore.
+func TestCredentialsStorage_SwappedCiphertext(t *testing.T) {
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST not set")
+	}
+	ctx := context.Background()
+
+	ds, err := datastore.NewClient(ctx, "usos-notifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	c := newTestCipher(t)
+	storage := NewCredentialsStorage(ds, c.keyring, c.additionalData, false)
+
+	alice, bob := users.NewUserID("swap-test-alice"), users.NewUserID("swap-test-bob")
+	if err := storage.SaveCredentials(ctx, alice, &credentials.Credentials{User: "alice", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SaveCredentials(ctx, bob, &credentials.Credentials{User: "bob", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := storage.GetCredentials(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.User != "alice" || creds.Password != "secret" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+
+	// Copy alice's ciphertext over bob's credentials.
+	stored := encrypted{}
+	if err := ds.Get(ctx, datastore.NameKey(credentialsTable, alice.String(), nil), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.Put(ctx, datastore.NameKey(credentialsTable, bob.String(), nil), &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := storage.GetCredentials(ctx, bob); err == nil {
+		t.Error("expected swapped ciphertext to be rejected")
+	}
+}
+
+// TestCredentialsStorage_RecordInvalidPassword needs the Datastore emulator, see gcloud beta emulators datastore.
+func TestCredentialsStorage_RecordInvalidPassword(t *testing.T) {
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST not set")
+	}
+	ctx := context.Background()
+
+	ds, err := datastore.NewClient(ctx, "usos-notifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	c := newTestCipher(t)
+	storage := NewCredentialsStorage(ds, c.keyring, c.additionalData, false)
+
+	userID := users.NewUserID("invalid-password-test")
+	if err := storage.SaveCredentials(ctx, userID, &credentials.Credentials{User: "user", Password: "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A successful login in between resets the count.
+	for i, expected := range []bool{false, false, false, false, true, false} {
+		if i == 2 {
+			if err := storage.SetLastLogin(ctx, userID, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stale, err := storage.RecordInvalidPassword(ctx, userID, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stale != expected {
+			t.Errorf("failure %d: expected marked stale %v, got %v", i, expected, stale)
+		}
+	}
+
+	creds, err := storage.GetCredentials(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !creds.Stale {
+		t.Error("expected stale credentials")
+	}
+
+	if err := storage.SaveCredentials(ctx, userID, &credentials.Credentials{User: "user", Password: "new"}); err != nil {
+		t.Fatal(err)
+	}
+	creds, err = storage.GetCredentials(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Stale || creds.InvalidPasswordFailures != 0 {
+		t.Errorf("expected new credentials to reset staleness, got %+v", creds)
+	}
+}
+
+// TestCredentialsStorage_NotFound needs the Datastore emulator, see gcloud beta emulators datastore.
+func TestCredentialsStorage_NotFound(t *testing.T) {
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST not set")
+	}
+	ctx := context.Background()
+
+	ds, err := datastore.NewClient(ctx, "usos-notifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	c := newTestCipher(t)
+	storage := NewCredentialsStorage(ds, c.keyring, c.additionalData, false)
+
+	if _, err := storage.GetCredentials(ctx, users.NewUserID("not-found-test")); err != credentials.ErrCredentialsNotFound {
+		t.Errorf("expected ErrCredentialsNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package datastore
+
+import (
+	"context"
+	"time"
+
+	"github.com/cube2222/usos-notifier/credentials"
+
+	"cloud.google.com/go/datastore"
+	"github.com/pkg/errors"
+)
+
+const pendingAuthorizationTable = "pending_authorizations"
+
+// pendingAuthorizationTTL is how long the user has to authorize the request token.
+const pendingAuthorizationTTL = time.Hour
+
+var ErrPendingAuthorizationNotFound = errors.New("pending authorization not found")
+
+type PendingAuthorizations struct {
+	ds *datastore.Client
+}
+
+func NewPendingAuthorizationStorage(cli *datastore.Client) credentials.PendingAuthorizationStorage {
+	return &PendingAuthorizations{
+		ds: cli,
+	}
+}
+
+type datastorePendingAuthorization struct {
+	Token              string
+	University         string
+	RequestTokenSecret string
+	CreatedAt          time.Time
+}
+
+func (p *PendingAuthorizations) SavePendingAuthorization(ctx context.Context, requestToken string, authorization *credentials.PendingAuthorization) error {
+	key := datastore.NameKey(pendingAuthorizationTable, requestToken, nil)
+	_, err := p.ds.Put(ctx, key, &datastorePendingAuthorization{
+		Token:              authorization.Token,
+		University:         authorization.University,
+		RequestTokenSecret: authorization.RequestTokenSecret,
+		CreatedAt:          authorization.CreatedAt,
+	})
+	if err != nil {
+		return errors.Wrap(err, "couldn't put pending authorization into db")
+	}
+
+	return nil
+}
+
+func (p *PendingAuthorizations) TakePendingAuthorization(ctx context.Context, requestToken string) (*credentials.PendingAuthorization, error) {
+	key := datastore.NameKey(pendingAuthorizationTable, requestToken, nil)
+
+	out := datastorePendingAuthorization{}
+	_, err := p.ds.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		err := tx.Get(key, &out)
+		if err == datastore.ErrNoSuchEntity {
+			return ErrPendingAuthorizationNotFound
+		}
+		if err != nil {
+			return errors.Wrap(err, "couldn't get pending authorization")
+		}
+
+		return tx.Delete(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if time.Since(out.CreatedAt) > pendingAuthorizationTTL {
+		return nil, errors.Wrap(ErrPendingAuthorizationNotFound, "pending authorization expired")
+	}
+
+	return &credentials.PendingAuthorization{
+		Token:              out.Token,
+		University:         out.University,
+		RequestTokenSecret: out.RequestTokenSecret,
+		CreatedAt:          out.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,135 @@
+package datastore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/credentials"
+)
+
+// Record versions, saved unencrypted with the ciphertext and bound to it by the additional authenticated data.
+const (
+	// legacyRecordVersion is the "len-user-len-password" format, with shared additional authenticated data.
+	legacyRecordVersion = 0
+	// userBoundRecordVersion is the legacy format, with additional authenticated data bound to the user.
+	userBoundRecordVersion = 1
+	// jsonRecordVersion is the JSON record.
+	jsonRecordVersion = 2
+	// loginStateRecordVersion is the JSON record, with the login state saved unencrypted next to it.
+	loginStateRecordVersion = 3
+
+	currentRecordVersion = loginStateRecordVersion
+)
+
+type record struct {
+	User              string    `json:"user"`
+	Password          string    `json:"password,omitempty"`
+	AccessToken       string    `json:"access_token,omitempty"`
+	AccessTokenSecret string    `json:"access_token_secret,omitempty"`
+	University        string    `json:"university,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	// LastLogin, InvalidPasswordFailures and Stale are only read from records older than loginStateRecordVersion.
+	LastLogin               time.Time `json:"last_login"`
+	InvalidPasswordFailures int       `json:"invalid_password_failures,omitempty"`
+	Stale                   bool      `json:"stale,omitempty"`
+}
+
+func encodeRecord(creds *credentials.Credentials) ([]byte, error) {
+	return json.Marshal(&record{
+		User:              creds.User,
+		Password:          creds.Password,
+		AccessToken:       creds.AccessToken,
+		AccessTokenSecret: creds.AccessTokenSecret,
+		University:        creds.University,
+		CreatedAt:         creds.CreatedAt,
+		UpdatedAt:         creds.UpdatedAt,
+	})
+}
+
+func decodeRecord(version int, data []byte) (*credentials.Credentials, error) {
+	switch version {
+	case legacyRecordVersion, userBoundRecordVersion:
+		return decodeUserAndPassword(string(data))
+	case jsonRecordVersion, loginStateRecordVersion:
+		r := record{}
+		err := json.Unmarshal(data, &r)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't unmarshal record")
+		}
+		if r.User == "" {
+			return nil, errors.New("missing user")
+		}
+		if r.Password == "" && (r.AccessToken == "" || r.AccessTokenSecret == "") {
+			return nil, errors.New("missing password or access token")
+		}
+
+		return &credentials.Credentials{
+			User:              r.User,
+			Password:          r.Password,
+			AccessToken:       r.AccessToken,
+			AccessTokenSecret: r.AccessTokenSecret,
+			University:        r.University,
+			CreatedAt:         r.CreatedAt,
+			UpdatedAt:         r.UpdatedAt,
+			LastLogin:         r.LastLogin,
+
+			InvalidPasswordFailures: r.InvalidPasswordFailures,
+			Stale:                   r.Stale,
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown record version %d", version)
+	}
+}
+
+func encodeUserAndPassword(user, password string) string {
+	return fmt.Sprintf("%d-%s-%d-%s", len(user), user, len(password), password)
+}
+
+func decodeUserAndPassword(encoded string) (*credentials.Credentials, error) {
+	user, rest, err := decodeLengthPrefixed(encoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid username")
+	}
+	if !strings.HasPrefix(rest, "-") {
+		return nil, errors.New("missing dash after username")
+	}
+	password, rest, err := decodeLengthPrefixed(rest[1:])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid password")
+	}
+	if rest != "" {
+		return nil, errors.New("unexpected data after password")
+	}
+
+	return &credentials.Credentials{
+		User:     user,
+		Password: password,
+	}, nil
+}
+
+// decodeLengthPrefixed decodes a "len-value" prefix of s, returning the value and the rest of s.
+func decodeLengthPrefixed(s string) (value, rest string, err error) {
+	i := strings.Index(s, "-")
+	if i == -1 {
+		return "", "", errors.New("missing length")
+	}
+	length, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return "", "", errors.Wrap(err, "invalid length")
+	}
+	if strconv.Itoa(length) != s[:i] {
+		return "", "", errors.Errorf("non-canonical length %v", s[:i])
+	}
+	s = s[i+1:]
+	if length < 0 || length > len(s) {
+		return "", "", errors.Errorf("length %d out of bounds", length)
+	}
+
+	return s[:length], s[length:], nil
+}
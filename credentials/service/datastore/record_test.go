@@ -0,0 +1,139 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cube2222/usos-notifier/credentials"
+)
+
+func TestDecodeRecord(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	creds := &credentials.Credentials{
+		User:       "ab123456",
+		Password:   "pass-word-",
+		University: "uw",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	data, err := encodeRecord(creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenCreds := &credentials.Credentials{
+		User:              "123456",
+		AccessToken:       "token",
+		AccessTokenSecret: "secret",
+		University:        "uw",
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	tokenData, err := encodeRecord(tokenCreds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Records older than loginStateRecordVersion hold the login state.
+	withLoginState := *creds
+	withLoginState.LastLogin = now
+	withLoginState.InvalidPasswordFailures = 2
+	withLoginState.Stale = true
+	loginStateData := `{"user":"ab123456","password":"pass-word-","university":"uw","created_at":"2026-10-18T12:00:00Z",` +
+		`"updated_at":"2026-10-18T12:00:00Z","last_login":"2026-10-18T12:00:00Z","invalid_password_failures":2,"stale":true}`
+
+	for _, c := range []struct {
+		version int
+		data    string
+		want    *credentials.Credentials
+	}{
+		{loginStateRecordVersion, string(data), creds},
+		{loginStateRecordVersion, string(tokenData), tokenCreds},
+		{jsonRecordVersion, string(data), creds},
+		{jsonRecordVersion, loginStateData, &withLoginState},
+		{legacyRecordVersion, encodeUserAndPassword("ab123456", "pass-word-"), &credentials.Credentials{User: "ab123456", Password: "pass-word-"}},
+		{userBoundRecordVersion, "0--0-", &credentials.Credentials{}},
+	} {
+		got, err := decodeRecord(c.version, []byte(c.data))
+		if err != nil {
+			t.Fatalf("version %d: %v", c.version, err)
+		}
+		if *got != *c.want {
+			t.Errorf("version %d: expected %+v, got %+v", c.version, c.want, got)
+		}
+	}
+
+	for _, c := range []struct {
+		version int
+		data    string
+	}{
+		{legacyRecordVersion, "5-user-4-pass"},
+		{legacyRecordVersion, "4-user-9-pass"},
+		{legacyRecordVersion, "4-user-4-passextra"},
+		{legacyRecordVersion, "99999999999999999999-user"},
+		{legacyRecordVersion, "4-user"},
+		{jsonRecordVersion, `{"user":"ab123456"}`},
+		{jsonRecordVersion, `{"user":"123456","access_token":"token"}`},
+		{jsonRecordVersion, "4-user-4-pass"},
+		{4, string(data)},
+	} {
+		if _, err := decodeRecord(c.version, []byte(c.data)); err == nil {
+			t.Errorf("version %d: expected error decoding %q", c.version, c.data)
+		}
+	}
+}
+
+func FuzzDecodeUserAndPassword(f *testing.F) {
+	f.Add("4-user-8-password")
+	f.Add("0--0-")
+	f.Add("3-a-b-1-c")
+	f.Add("5-user-4-pass")
+	f.Add("-1--1-")
+	f.Fuzz(func(t *testing.T, encoded string) {
+		creds, err := decodeUserAndPassword(encoded)
+		if err != nil {
+			return
+		}
+		// Whatever decodes has to be the canonical encoding of the result.
+		if reencoded := encodeUserAndPassword(creds.User, creds.Password); reencoded != encoded {
+			t.Errorf("decoded %q as %+v, which encodes as %q", encoded, creds, reencoded)
+		}
+	})
+}
+
+func FuzzUserAndPasswordRoundTrip(f *testing.F) {
+	f.Add("user", "password")
+	f.Add("", "")
+	f.Add("1-a", "-2-")
+	f.Fuzz(func(t *testing.T, user, password string) {
+		creds, err := decodeUserAndPassword(encodeUserAndPassword(user, password))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.User != user || creds.Password != password {
+			t.Errorf("expected %q and %q, got %+v", user, password, creds)
+		}
+	})
+}
+
+func FuzzDecodeRecord(f *testing.F) {
+	f.Add(jsonRecordVersion, []byte(`{"user":"u","password":"p","created_at":"2026-10-18T12:00:00Z"}`))
+	f.Add(jsonRecordVersion, []byte(`{"user":1}`))
+	f.Add(legacyRecordVersion, []byte("4-user-8-password"))
+	f.Fuzz(func(t *testing.T, version int, data []byte) {
+		creds, err := decodeRecord(version, data)
+		if err != nil || version != jsonRecordVersion {
+			return
+		}
+		encoded, err := encodeRecord(creds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := decodeRecord(version, encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.User != creds.User || again.Password != creds.Password || again.University != creds.University {
+			t.Errorf("expected %+v after round trip, got %+v", creds, again)
+		}
+	})
+}
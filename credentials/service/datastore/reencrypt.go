@@ -0,0 +1,129 @@
+package datastore
+
+import (
+	"context"
+
+	"cloud.google.com/go/datastore"
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/credentials/encryption"
+)
+
+// ReEncrypter re-encrypts stored credentials with the current key, additional authenticated data and record format,
+// so previous ones can be retired.
+type ReEncrypter struct {
+	storage *credentialsStorage
+	ds      *datastore.Client
+}
+
+func NewReEncrypter(ds *datastore.Client, keyring *encryption.Keyring, additionalData *encryption.AdditionalData) *ReEncrypter {
+	return &ReEncrypter{
+		storage: &credentialsStorage{
+			cipher: &cipher{
+				keyring:        keyring,
+				additionalData: additionalData,
+			},
+			ds: ds,
+		},
+		ds: ds,
+	}
+}
+
+// Count returns the number of stored credentials.
+func (r *ReEncrypter) Count(ctx context.Context) (int, error) {
+	n, err := r.ds.Count(ctx, datastore.NewQuery(credentialsTable).KeysOnly())
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't count credentials")
+	}
+
+	return n, nil
+}
+
+// CountLegacy returns the number of stored credentials still using the legacy record format.
+func (r *ReEncrypter) CountLegacy(ctx context.Context) (int, error) {
+	// Credentials saved before versioning have no version property, so they can't be filtered on.
+	var all []*encrypted
+	_, err := r.ds.GetAll(ctx, datastore.NewQuery(credentialsTable), &all)
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't list credentials")
+	}
+
+	n := 0
+	for _, encrypted := range all {
+		if encrypted.Version == legacyRecordVersion {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// ReEncryptBatch re-encrypts up to limit credentials of users following the given one, in user ID order.
+// It returns the last user handled, which can be passed to the next call, and how many credentials were checked and re-encrypted.
+// Credentials which are already current are skipped, so the job can be safely resumed from any point.
+func (r *ReEncrypter) ReEncryptBatch(ctx context.Context, after users.UserID, limit int) (last users.UserID, checked, reencrypted int, err error) {
+	query := datastore.NewQuery(credentialsTable).KeysOnly().Order("__key__").Limit(limit)
+	if after != "" {
+		query = query.Filter("__key__ >", datastore.NameKey(credentialsTable, after.String(), nil))
+	}
+	keys, err := r.ds.GetAll(ctx, query, nil)
+	if err != nil {
+		return "", 0, 0, errors.Wrap(err, "couldn't list credentials")
+	}
+
+	for _, key := range keys {
+		changed, err := r.reEncrypt(ctx, key)
+		if err != nil {
+			return last, checked, reencrypted, errors.Wrapf(err, "couldn't re-encrypt credentials of user %v", key.Name)
+		}
+		if changed {
+			reencrypted++
+		}
+		last = users.NewUserID(key.Name)
+		checked++
+	}
+
+	return last, checked, reencrypted, nil
+}
+
+func (r *ReEncrypter) reEncrypt(ctx context.Context, key *datastore.Key) (bool, error) {
+	changed := false
+	// The transaction makes sure credentials saved in the meantime aren't overwritten.
+	_, err := r.ds.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		changed = false
+
+		current := encrypted{}
+		err := tx.Get(key, &current)
+		if err == datastore.ErrNoSuchEntity {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "couldn't get encrypted credentials")
+		}
+		if r.storage.cipher.isCurrent(&current) {
+			return nil
+		}
+
+		userID := users.NewUserID(key.Name)
+		creds, err := r.storage.decode(ctx, userID, &current)
+		if err != nil {
+			return err
+		}
+		// Legacy records are converted to the current format.
+		updated, err := r.storage.encode(ctx, userID, creds)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Put(key, updated)
+		if err != nil {
+			return errors.Wrap(err, "couldn't save credentials")
+		}
+		changed = true
+
+		return nil
+	})
+
+	return changed, err
+}
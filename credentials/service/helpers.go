@@ -6,18 +6,34 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cube2222/usos-notifier/common/tracing"
+	"github.com/cube2222/usos-notifier/common/universities"
+	"github.com/cube2222/usos-notifier/credentials"
 )
 
 var ErrAlreadySavedMsg = "Already saved."
 
-var ltRegexp = regexp.MustCompile("LT-[a-zA-Z0-9]+-[a-zA-Z0-9]+")
+// login logs into USOSweb through CAS, returning the USOSweb session.
+// Failures are classified using the login errors of the credentials package.
+func login(ctx context.Context, university *universities.University, user, password string) (session string, err error) {
+	defer func(start time.Time) {
+		observeLogin(start, err)
+	}(time.Now())
+	ctx, span := tracing.StartSpan(ctx, "usos.login",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("usos.university", university.ID)),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
 
-func login(ctx context.Context, user, password string) (string, error) {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		return "", errors.Wrap(err, "couldn't create empty cookiejar")
@@ -42,14 +58,16 @@ func login(ctx context.Context, user, password string) (string, error) {
 		},
 	}
 
-	uri, err := url.Parse("https://logowanie.uw.edu.pl/cas/login")
+	uri, err := url.Parse(university.CASLoginURL)
 	if err != nil {
 		return "", errors.Wrap(err, "couldn't parse request url")
 	}
 
 	q := uri.Query()
-	q.Add("service", "https://usosweb.mimuw.edu.pl/kontroler.php?_action=logowaniecas/index")
-	q.Add("locale", "pl")
+	q.Add("service", university.ServiceURL())
+	for key, value := range university.LoginQuery {
+		q.Add(key, value)
+	}
 	uri.RawQuery = q.Encode()
 
 	req, err := http.NewRequest(http.MethodGet, uri.String(), nil)
@@ -61,50 +79,65 @@ func login(ctx context.Context, user, password string) (string, error) {
 
 	resp, err := cli.Do(req)
 	if err != nil {
-		return "", errors.Wrap(err, "couldn't get login page")
+		return "", errors.Wrapf(credentials.ErrCASUnavailable, "couldn't get login page: %v", err)
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
 	if err != nil {
-		return "", errors.Wrap(err, "couldn't read login page body")
+		return "", errors.Wrapf(credentials.ErrCASUnavailable, "couldn't read login page body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Wrapf(unexpectedStatusError(resp.StatusCode), "couldn't get login page, received code %v", resp.StatusCode)
 	}
 
-	LT := ltRegexp.Find(data)
+	LT := university.FindLoginTicket(data)
 	if len(LT) == 0 {
-		return "", errors.Wrap(err, "couldn't retrieve login token from the login page body")
+		return "", errors.Wrap(credentials.ErrPageFormatChanged, "couldn't retrieve login token from the login page body")
 	}
 
 	form := url.Values{}
 	form.Add("username", user)
 	form.Add("password", password)
 	form.Add("lt", string(LT))
-	form.Add("execution", "e1s1")
-	form.Add("_eventId", "submit")
-	form.Add("submit", "ZALOGUJ")
+	for key, value := range university.LoginForm {
+		form.Add(key, value)
+	}
 
 	// TODO: Identify myself using the UserAgent
-	resp, err = cli.PostForm(uri.String(), form)
+	req, err = http.NewRequest(http.MethodPost, uri.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't create login request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(ctx)
+
+	resp, err = cli.Do(req)
 	// USOS throws us into an infinite redirection loop. So we're breaking
 	// after the first redirect which provided us with the USOS session token.
 	if err != nil && !strings.Contains(err.Error(), ErrAlreadySavedMsg) {
-		return "", errors.Wrap(err, "couldn't login")
+		return "", errors.Wrapf(credentials.ErrCASUnavailable, "couldn't login: %v", err)
+	}
+	if redir == "" {
+		// CAS only redirects to USOSweb after a successful login, otherwise it shows the login page with an error.
+		return "", loginFailure(university, resp)
 	}
 
 	// It seems like the session cookie gets changed to a proper one after the first request.
 	// We have to do this first request here.
-	req, err = http.NewRequest("GET", "https://usosweb.mimuw.edu.pl/kontroler.php?_action=news/default", nil)
+	req, err = http.NewRequest("GET", university.USOSwebURL+"/kontroler.php?_action=news/default", nil)
 	if err != nil {
 		return "", errors.Wrap(err, "couldn't create repeat get request")
 	}
-	req.WithContext(ctx)
+	req = req.WithContext(ctx)
 
 	redir = ""
 	_, err = cli.Do(req)
 	if err != nil && !strings.Contains(err.Error(), ErrAlreadySavedMsg) {
-		return "", errors.Wrap(err, "couldn't do repeat request")
+		return "", errors.Wrapf(credentials.ErrCASUnavailable, "couldn't do repeat request: %v", err)
 	}
 
-	parsed, err := url.Parse("https://usosweb.mimuw.edu.pl")
+	parsed, err := url.Parse(university.USOSwebURL)
 	if err != nil {
 		return "", errors.Wrap(err, "couldn't parse url for usos session cookie extraction")
 	}
@@ -113,5 +146,33 @@ func login(ctx context.Context, user, password string) (string, error) {
 			return cookie.Value, nil
 		}
 	}
-	return "", errors.New("usos session cookie not found")
+	return "", errors.Wrap(credentials.ErrSessionCookieMissing, "usos session cookie not found")
+}
+
+// loginFailure classifies the failure using the page CAS showed after submitting the login form.
+func loginFailure(university *universities.University, resp *http.Response) error {
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return errors.Wrapf(credentials.ErrCASUnavailable, "couldn't read login response body: %v", err)
+	}
+
+	switch {
+	case university.IsAccountLocked(data):
+		return errors.Wrap(credentials.ErrAccountLocked, "couldn't login")
+	case university.IsInvalidPassword(data):
+		return errors.Wrap(credentials.ErrInvalidPassword, "couldn't login")
+	case resp.StatusCode != http.StatusOK:
+		return errors.Wrapf(unexpectedStatusError(resp.StatusCode), "couldn't login, received code %v", resp.StatusCode)
+	default:
+		return errors.Wrap(credentials.ErrPageFormatChanged, "couldn't login, no redirect and no known error message")
+	}
+}
+
+// unexpectedStatusError is ErrCASUnavailable for server errors, which should go away, and ErrPageFormatChanged otherwise.
+func unexpectedStatusError(code int) error {
+	if code >= http.StatusInternalServerError || code == http.StatusTooManyRequests {
+		return credentials.ErrCASUnavailable
+	}
+	return credentials.ErrPageFormatChanged
 }
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/universities"
+	"github.com/cube2222/usos-notifier/credentials"
+)
+
+func TestLoginFailures(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cas/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `<input type="hidden" name="lt" value="LT-1-abc">`)
+			return
+		}
+		switch r.PostFormValue("username") {
+		case "locked":
+			fmt.Fprint(w, `<div id="msg" class="errors">Konto zostało zablokowane.</div>`)
+		case "invalid":
+			fmt.Fprint(w, `<div id="msg" class="errors">Nieprawidłowy identyfikator lub hasło.</div>`)
+		case "changed":
+			fmt.Fprint(w, `<div>Something else.</div>`)
+		case "down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "nocookie":
+			http.Redirect(w, r, server.URL+"/usosweb?nocookie=true", http.StatusFound)
+		default:
+			http.Redirect(w, r, server.URL+"/usosweb", http.StatusFound)
+		}
+	})
+	mux.HandleFunc("/usosweb", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("nocookie") == "" {
+			http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: "session", Path: "/"})
+		}
+	})
+	mux.HandleFunc("/kontroler.php", func(w http.ResponseWriter, r *http.Request) {})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	registry, err := universities.NewRegistry(universities.DefaultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	university := *universities.Builtin()[0]
+	university.ID = "test"
+	university.CASLoginURL = server.URL + "/cas/login"
+	university.USOSwebURL = server.URL
+	err = registry.Add(&university)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := registry.Get("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := login(context.Background(), u, "user", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session != "session" {
+		t.Errorf("unexpected session %v", session)
+	}
+
+	for user, expected := range map[string]error{
+		"locked":   credentials.ErrAccountLocked,
+		"invalid":  credentials.ErrInvalidPassword,
+		"changed":  credentials.ErrPageFormatChanged,
+		"down":     credentials.ErrCASUnavailable,
+		"nocookie": credentials.ErrSessionCookieMissing,
+	} {
+		_, err := login(context.Background(), u, user, "password")
+		if errors.Cause(err) != expected {
+			t.Errorf("%v: expected %v, got %v", user, expected, err)
+		}
+	}
+
+	server.Close()
+	_, err = login(context.Background(), u, "user", "password")
+	if errors.Cause(err) != credentials.ErrCASUnavailable {
+		t.Errorf("expected %v with CAS down, got %v", credentials.ErrCASUnavailable, err)
+	}
+}
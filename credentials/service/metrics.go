@@ -0,0 +1,63 @@
+package service
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/cube2222/usos-notifier/common/metrics"
+	"github.com/cube2222/usos-notifier/credentials"
+)
+
+var (
+	usosLogins = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "usos_logins_total",
+			Help: "Number of USOS logins, by outcome.",
+		},
+		[]string{"outcome"},
+	)
+	sessionCacheLookups = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "session_cache_lookups_total",
+			Help: "Number of USOS session cache lookups, by result.",
+		},
+		[]string{"result"},
+	)
+	usosLoginDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "usos_login_duration_seconds",
+			Help:    "Time it took to log into USOS.",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+)
+
+func observeLogin(start time.Time, err error) {
+	outcome := metrics.Outcome(err)
+	switch errors.Cause(err) {
+	case credentials.ErrInvalidPassword:
+		outcome = "invalid_password"
+	case credentials.ErrAccountLocked:
+		outcome = "account_locked"
+	case credentials.ErrCASUnavailable:
+		outcome = "cas_unavailable"
+	case credentials.ErrPageFormatChanged:
+		outcome = "page_format_changed"
+	case credentials.ErrSessionCookieMissing:
+		outcome = "session_cookie_missing"
+	}
+
+	usosLoginDuration.Observe(time.Since(start).Seconds())
+	usosLogins.WithLabelValues(outcome).Inc()
+}
+
+func observeSessionCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	sessionCacheLookups.WithLabelValues(result).Inc()
+}
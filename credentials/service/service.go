@@ -5,62 +5,147 @@ import (
 	"html/template"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/cube2222/grpc-utils/logger"
+	"github.com/cube2222/usos-notifier/common/events/outbox"
 	"github.com/cube2222/usos-notifier/common/events/publisher"
 	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	"github.com/cube2222/usos-notifier/common/universities"
 	"github.com/cube2222/usos-notifier/common/users"
 	"github.com/cube2222/usos-notifier/credentials"
 	"github.com/cube2222/usos-notifier/notifier"
 
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Service struct {
-	creds     credentials.CredentialsStorage
-	publisher *publisher.Publisher
-	tokens    credentials.TokenStorage
-	sender    notifier.NotificationSender
-
-	tmpl        *template.Template
-	tokenRegexp *regexp.Regexp
-
-	credentialsReceivedTopic string
+	creds  credentials.CredentialsStorage
+	tokens credentials.TokenStorage
+	sender notifier.NotificationSender
+
+	tmpl         *template.Template
+	tokenRegexp  *regexp.Regexp
+	sessions     *sessionCache
+	universities *universities.Registry
+	usosAPI      *usosAPIConfig
+
+	credentialsReceivedTopic    string
+	credentialsInvalidatedTopic string
+	maxInvalidPasswordFailures  int
 }
 
-func NewService(credentialsStorage credentials.CredentialsStorage, tokenStorage credentials.TokenStorage, notificationSender notifier.NotificationSender, publisher *publisher.Publisher, authorizationTemplate *template.Template, credentialsReceivedTopic string) (*Service, error) {
+func NewService(credentialsStorage credentials.CredentialsStorage, tokenStorage credentials.TokenStorage, notificationSender notifier.NotificationSender, authorizationTemplate *template.Template, universities *universities.Registry, credentialsReceivedTopic, credentialsInvalidatedTopic string, sessionTTL time.Duration, maxInvalidPasswordFailures int) (*Service, error) {
 	tokenRegexp := regexp.MustCompile("^[0-9]+$")
 
 	service := &Service{
-		creds:                    credentialsStorage,
-		publisher:                publisher,
-		tokens:                   tokenStorage,
-		sender:                   notificationSender,
-		tmpl:                     authorizationTemplate,
-		tokenRegexp:              tokenRegexp,
-		credentialsReceivedTopic: credentialsReceivedTopic,
+		creds:                       credentialsStorage,
+		tokens:                      tokenStorage,
+		sender:                      notificationSender,
+		tmpl:                        authorizationTemplate,
+		tokenRegexp:                 tokenRegexp,
+		universities:                universities,
+		credentialsReceivedTopic:    credentialsReceivedTopic,
+		credentialsInvalidatedTopic: credentialsInvalidatedTopic,
+		maxInvalidPasswordFailures:  maxInvalidPasswordFailures,
 	}
+	service.sessions = newSessionCache(sessionTTL, service.login)
 
 	return service, nil
 }
 
 func (s *Service) GetSession(ctx context.Context, r *credentials.GetSessionRequest) (*credentials.GetSessionResponse, error) {
-	creds, err := s.creds.GetCredentials(ctx, users.UserID(r.Userid))
+	ctx = users.WithLogger(ctx, users.UserID(r.Userid))
+
+	session, err := s.sessions.Get(ctx, users.UserID(r.Userid))
+	if errors.Cause(err) == errNoPassword {
+		return nil, status.Error(codes.InvalidArgument, "the user authorized through the USOS API, use GetAccessToken")
+	}
+	if errors.Cause(err) == credentials.ErrCredentialsNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, credentials.LoginErrorStatus(err)
+	}
+
+	return &credentials.GetSessionResponse{
+		Sessionid:  session.ID,
+		University: session.University.ID,
+		UsoswebUrl: session.University.USOSwebURL,
+	}, nil
+}
+
+func (s *Service) InvalidateSession(ctx context.Context, r *credentials.InvalidateSessionRequest) (*credentials.InvalidateSessionResponse, error) {
+	s.sessions.Invalidate(users.UserID(r.Userid), r.Sessionid)
+
+	return &credentials.InvalidateSessionResponse{}, nil
+}
+
+// login logs the user in using the stored credentials.
+func (s *Service) login(ctx context.Context, userID users.UserID) (*usosSession, error) {
+	creds, err := s.creds.GetCredentials(ctx, userID)
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't get credentials")
 	}
+	if creds.HasAccessToken() {
+		return nil, errNoPassword
+	}
+	if creds.Stale {
+		// Trying stale credentials again could get the account locked.
+		return nil, errors.Wrap(credentials.ErrInvalidPassword, "credentials are stale, waiting for the user to authorize again")
+	}
+	university, err := s.universities.Get(creds.University)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get university")
+	}
 
-	session, err := login(ctx, creds.User, creds.Password)
+	session, err := login(ctx, university, creds.User, creds.Password)
+	if errors.Cause(err) == credentials.ErrInvalidPassword {
+		s.recordInvalidPassword(ctx, userID, s.maxInvalidPasswordFailures)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't login")
 	}
 
-	return &credentials.GetSessionResponse{
-		Sessionid: session,
+	err = s.creds.SetLastLogin(ctx, userID, time.Now())
+	if err != nil {
+		logger.FromContext(ctx).Printf("Couldn't save last login time: %v", err)
+	}
+
+	return &usosSession{
+		ID:         session,
+		University: university,
 	}, nil
 }
 
+// recordInvalidPassword marks the credentials stale after maxFailures invalid password failures in a row,
+// publishing a credentials invalidated event, so the user is asked to authorize again.
+func (s *Service) recordInvalidPassword(ctx context.Context, userID users.UserID, maxFailures int) {
+	log := logger.FromContext(ctx)
+
+	credentialsInvalidated, err := outbox.NewEvent(ctx, s.credentialsInvalidatedTopic, map[string]string{
+		publisher.UserIDKey: userID.String(),
+	}, &credentials.CredentialsInvalidatedEvent{
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Couldn't create credentials invalidated event: %v", err)
+		return
+	}
+
+	stale, err := s.creds.RecordInvalidPassword(ctx, userID, maxFailures, credentialsInvalidated)
+	if err != nil {
+		log.Printf("Couldn't record invalid password: %v", err)
+		return
+	}
+	if stale {
+		log.Printf("Marked credentials stale after %d invalid password failures.", maxFailures)
+	}
+}
+
 func (s *Service) HandleAuthorizationPageHTTP(w http.ResponseWriter, r *http.Request) {
 	token := r.URL.Query().Get("token")
 
@@ -80,6 +165,11 @@ func (s *Service) HandleAuthorizeHTTP(w http.ResponseWriter, r *http.Request) {
 	username := r.PostFormValue("username")
 	password := r.PostFormValue("password")
 	token := r.PostFormValue("token")
+	university, err := s.universities.Get(r.PostFormValue("university"))
+	if err != nil {
+		s.writeAuthorizePage(token, "Unknown university.", w, r)
+		return
+	}
 
 	if username == "" {
 		s.writeAuthorizePage(token, "Missing username.", w, r)
@@ -99,27 +189,47 @@ func (s *Service) HandleAuthorizeHTTP(w http.ResponseWriter, r *http.Request) {
 		s.writeAuthorizePage(token, "Invalid token.", w, r)
 		return
 	}
+	r = r.WithContext(users.WithLogger(r.Context(), userID))
+	log = logger.FromContext(r.Context())
 
-	_, err = login(r.Context(), username, password)
+	_, err = login(r.Context(), university, username, password)
 	if err != nil {
-		s.writeAuthorizePage(token, "Invalid credentials.", w, r)
+		s.writeAuthorizePage(token, loginFailureMessage(err), w, r)
 		log.Println(err)
 		return
 	}
 
-	err = s.creds.SaveCredentials(r.Context(), userID, username, password)
+	s.saveCredentials(token, userID, &credentials.Credentials{
+		User:       username,
+		Password:   password,
+		University: university.ID,
+		LastLogin:  time.Now(),
+	}, w, r)
+}
+
+// saveCredentials saves the credentials the user provided with the authorization token and lets marks know about them.
+func (s *Service) saveCredentials(token string, userID users.UserID, creds *credentials.Credentials, w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+
+	credentialsReceived, err := outbox.NewEvent(r.Context(), s.credentialsReceivedTopic, map[string]string{
+		publisher.UserIDKey: userID.String(),
+	}, &credentials.CredentialsReceivedEvent{
+		UserID: userID,
+	})
 	if err != nil {
 		s.writeAuthorizePage(token, "Internal error.", w, r)
 		log.Println(err)
 		return
 	}
 
-	err = s.publisher.PublishEvent(r.Context(), s.credentialsReceivedTopic, nil, userID.String())
+	err = s.creds.SaveCredentials(r.Context(), userID, creds, credentialsReceived)
 	if err != nil {
 		s.writeAuthorizePage(token, "Internal error.", w, r)
 		log.Println(err)
 		return
 	}
+	// The cached session may have been for the previous credentials.
+	s.sessions.Invalidate(userID, "")
 
 	err = s.sender.SendNotification(r.Context(), userID, "Otrzymałem Twoje dane logowania.")
 	if err != nil {
@@ -135,19 +245,45 @@ func (s *Service) HandleAuthorizeHTTP(w http.ResponseWriter, r *http.Request) {
 	// TODO: Write some success message
 }
 
+// loginFailureMessage tells the user why logging in with the credentials they provided failed.
+func loginFailureMessage(err error) string {
+	switch errors.Cause(err) {
+	case credentials.ErrInvalidPassword:
+		return "Invalid credentials."
+	case credentials.ErrAccountLocked:
+		return "Your account is locked, unlock it and try again."
+	case credentials.ErrCASUnavailable:
+		return "USOS is unavailable, please try again later."
+	default:
+		return "Couldn't log into USOS, please try again later."
+	}
+}
+
 type signupPageParams struct {
 	Token          string
 	MessagePresent bool
 	Message        string
+	Universities   []*universities.University
+	University     string
+	// USOSAPI is whether authorizing through the USOS API is available.
+	USOSAPI bool
 }
 
 func (s *Service) writeAuthorizePage(token, message string, w http.ResponseWriter, r *http.Request) {
 	log := logger.FromContext(r.Context())
 
+	university := r.PostFormValue("university")
+	if university == "" {
+		university = universities.DefaultID
+	}
+
 	params := signupPageParams{
 		Token:          token,
 		MessagePresent: message != "",
 		Message:        message,
+		Universities:   s.universities.List(),
+		University:     university,
+		USOSAPI:        s.usosAPI != nil,
 	}
 
 	err := s.tmpl.Execute(w, params)
@@ -160,13 +296,12 @@ func (s *Service) writeAuthorizePage(token, message string, w http.ResponseWrite
 	// TODO: Add links to the description of the app architecture and request the user to accept all terms. Checkboxes maybe
 }
 
-func (s *Service) HandleUserCreatedEvent(ctx context.Context, message *subscriber.Message) error {
-	text, err := subscriber.DecodeTextMessage(message)
-	if err != nil {
-		return subscriber.NewNonRetryableError(errors.Wrap(err, "couldn't decode text message"))
+func (s *Service) HandleUserCreatedEvent(ctx context.Context, message *subscriber.Message, e interface{}) error {
+	event, ok := e.(*notifier.UserCreatedEvent)
+	if !ok {
+		return subscriber.NewNonRetryableError(errors.Errorf("unexpected event type %T", e))
 	}
-
-	userID := users.NewUserID(string(text))
+	userID := event.UserID
 
 	token, err := s.tokens.GenerateAuthorizationToken(ctx, userID)
 	if err != nil {
@@ -182,10 +317,45 @@ func (s *Service) HandleUserCreatedEvent(ctx context.Context, message *subscribe
 	// as tokens get invalidated after the user provides the credentials.
 	// This is a low hanging fruit, but it's also totally unimportant.
 	err = s.sender.SendNotification(ctx, userID,
-		fmt.Sprintf("Proszę autoryzuj mnie do używania Twoich danych logowania: https://notifier.jacobmartins.com/credentials/authorization?token=%v", token))
+		fmt.Sprintf("Proszę autoryzuj mnie do używania Twoich danych logowania: %v", authorizationLink(token)))
 	if err != nil {
 		return errors.Wrap(err, "couldn't send notification")
 	}
 
 	return nil
 }
+
+// HandleCredentialsInvalidatedEvent asks the user to authorize again, sending them a fresh authorization link.
+func (s *Service) HandleCredentialsInvalidatedEvent(ctx context.Context, message *subscriber.Message, e interface{}) error {
+	event, ok := e.(*credentials.CredentialsInvalidatedEvent)
+	if !ok {
+		return subscriber.NewNonRetryableError(errors.Errorf("unexpected event type %T", e))
+	}
+	userID := event.UserID
+
+	creds, err := s.creds.GetCredentials(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get credentials")
+	}
+	if !creds.Stale {
+		// The user has already authorized again.
+		return nil
+	}
+
+	token, err := s.tokens.GenerateAuthorizationToken(ctx, userID)
+	if err != nil {
+		return errors.Wrap(err, "couldn't generate authorization token")
+	}
+
+	err = s.sender.SendNotification(ctx, userID,
+		fmt.Sprintf("Nie mogę zalogować się do USOS Twoimi danymi logowania, być może zmieniło się hasło. Sprawdzanie ocen jest wstrzymane. Proszę autoryzuj mnie ponownie: %v", authorizationLink(token)))
+	if err != nil {
+		return errors.Wrap(err, "couldn't send notification")
+	}
+
+	return nil
+}
+
+func authorizationLink(token string) string {
+	return fmt.Sprintf("https://notifier.jacobmartins.com/credentials/authorization?token=%v", token)
+}
@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 	"testing"
+
+	"github.com/cube2222/usos-notifier/common/universities"
 )
 
 /*
@@ -43,7 +45,16 @@ func TestService_GetSession(t *testing.T) {
 }
 */
 func TestService_login(t *testing.T) {
-	sess, err := login(context.Background(), os.Getenv("usos_user"), os.Getenv("usos_pass"))
+	registry, err := universities.NewRegistry(universities.DefaultID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	university, err := registry.Get("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := login(context.Background(), university, os.Getenv("usos_user"), os.Getenv("usos_pass"))
 	if err != nil {
 		t.Fatal(err)
 	}
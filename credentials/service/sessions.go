@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/cube2222/usos-notifier/common/universities"
+	"github.com/cube2222/usos-notifier/common/users"
+)
+
+// usosSession is a USOSweb session of a user.
+type usosSession struct {
+	ID         string
+	University *universities.University
+}
+
+type cachedSession struct {
+	session *usosSession
+	expires time.Time
+}
+
+// sessionCache caches USOS sessions per user, so not every GetSession has to log in.
+// Concurrent logins of the same user are shared.
+type sessionCache struct {
+	ttl   time.Duration
+	login func(ctx context.Context, userID users.UserID) (*usosSession, error)
+
+	mu       sync.Mutex
+	sessions map[users.UserID]cachedSession
+	// generations are bumped by Invalidate, logins started before that aren't cached.
+	generations map[users.UserID]uint64
+	logins      singleflight.Group
+}
+
+func newSessionCache(ttl time.Duration, login func(ctx context.Context, userID users.UserID) (*usosSession, error)) *sessionCache {
+	return &sessionCache{
+		ttl:         ttl,
+		login:       login,
+		sessions:    make(map[users.UserID]cachedSession),
+		generations: make(map[users.UserID]uint64),
+	}
+}
+
+// Get returns the cached session of the user, logging in if there's none.
+func (c *sessionCache) Get(ctx context.Context, userID users.UserID) (*usosSession, error) {
+	c.mu.Lock()
+	cached, ok := c.sessions[userID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		observeSessionCache(true)
+		return cached.session, nil
+	}
+	observeSessionCache(false)
+
+	// The login is shared by all callers, so it shouldn't be canceled with the first one of them.
+	loginCtx := context.WithoutCancel(ctx)
+	res := c.logins.DoChan(userID.String(), func() (interface{}, error) {
+		c.mu.Lock()
+		generation := c.generations[userID]
+		c.mu.Unlock()
+
+		session, err := c.login(loginCtx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if c.generations[userID] == generation {
+			c.sessions[userID] = cachedSession{
+				session: session,
+				expires: time.Now().Add(c.ttl),
+			}
+		}
+		c.mu.Unlock()
+
+		return session, nil
+	})
+
+	select {
+	case r := <-res:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*usosSession), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Invalidate drops the cached session of the user, if it's the given one. An empty session drops any.
+// Logins in progress aren't cached, as they may use outdated credentials.
+func (c *sessionCache) Invalidate(userID users.UserID, session string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[userID]++
+	c.logins.Forget(userID.String())
+	if cached, ok := c.sessions[userID]; ok && (session == "" || cached.session.ID == session) {
+		delete(c.sessions, userID)
+	}
+}
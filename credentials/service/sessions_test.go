@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/users"
+)
+
+func TestSessionCache(t *testing.T) {
+	ctx := context.Background()
+	var logins int32
+	release := make(chan struct{})
+	cache := newSessionCache(time.Minute, func(ctx context.Context, userID users.UserID) (*usosSession, error) {
+		n := atomic.AddInt32(&logins, 1)
+		<-release
+		return &usosSession{ID: fmt.Sprintf("%s-%d", userID, n)}, nil
+	})
+
+	// Concurrent callers share a single login.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session, err := cache.Get(ctx, "user")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if session.ID != "user-1" {
+				t.Errorf("expected session user-1, got %v", session.ID)
+			}
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+
+	if session, _ := cache.Get(ctx, "user"); session.ID != "user-1" || atomic.LoadInt32(&logins) != 1 {
+		t.Errorf("expected cached session user-1 after a single login, got %v after %d logins", session.ID, logins)
+	}
+
+	// Invalidating an older session keeps the cached one.
+	cache.Invalidate("user", "user-0")
+	if session, _ := cache.Get(ctx, "user"); session.ID != "user-1" {
+		t.Errorf("expected cached session user-1, got %v", session.ID)
+	}
+
+	cache.Invalidate("user", "user-1")
+	if session, _ := cache.Get(ctx, "user"); session.ID != "user-2" {
+		t.Errorf("expected new session user-2 after invalidation, got %v", session.ID)
+	}
+}
+
+func TestSessionCache_Expiry(t *testing.T) {
+	ctx := context.Background()
+	var logins int32
+	cache := newSessionCache(time.Millisecond*10, func(ctx context.Context, userID users.UserID) (*usosSession, error) {
+		return &usosSession{ID: fmt.Sprint(atomic.AddInt32(&logins, 1))}, nil
+	})
+
+	first, _ := cache.Get(ctx, "user")
+	time.Sleep(time.Millisecond * 20)
+	second, _ := cache.Get(ctx, "user")
+	if first.ID == second.ID {
+		t.Errorf("expected a new session after the ttl, got %v twice", first.ID)
+	}
+}
+
+func TestSessionCache_InvalidateDuringLogin(t *testing.T) {
+	ctx := context.Background()
+	password := "old"
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	cache := newSessionCache(time.Minute, func(ctx context.Context, userID users.UserID) (*usosSession, error) {
+		session := &usosSession{ID: password}
+		started <- struct{}{}
+		<-release
+		return session, nil
+	})
+
+	done := make(chan *usosSession)
+	go func() {
+		session, err := cache.Get(ctx, "user")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- session
+	}()
+	<-started
+
+	// New credentials are saved while the login with the old ones is in progress.
+	password = "new"
+	cache.Invalidate("user", "")
+	close(release)
+
+	if session := <-done; session.ID != "old" {
+		t.Errorf("expected the login in progress to return session old, got %v", session.ID)
+	}
+	if session, _ := cache.Get(ctx, "user"); session.ID != "new" {
+		t.Errorf("expected a new login after invalidation, got session %v", session.ID)
+	}
+}
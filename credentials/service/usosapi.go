@@ -0,0 +1,233 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cube2222/grpc-utils/logger"
+	"github.com/cube2222/usos-notifier/common/universities"
+	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/common/usosapi"
+	"github.com/cube2222/usos-notifier/credentials"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errNoPassword is returned when logging into USOSweb is impossible, because the user authorized through the USOS API.
+var errNoPassword = errors.New("user authorized through the USOS API")
+
+// usosAPIScopes are requested when authorizing through the USOS API,
+// offline_access keeps the access token valid until the user revokes it.
+var usosAPIScopes = []string{"studies", "crstests", "offline_access"}
+
+type usosAPIConfig struct {
+	pending     credentials.PendingAuthorizationStorage
+	consumers   map[string]usosapi.Consumer
+	callbackURL string
+	httpCli     *http.Client
+}
+
+// WithUSOSAPI enables authorizing through the USOS API for universities with a consumer, keyed by university ID.
+// The USOS API redirects the user back to callbackURL, which should be handled by HandleUSOSAPICallbackHTTP.
+func (s *Service) WithUSOSAPI(pending credentials.PendingAuthorizationStorage, consumers map[string]usosapi.Consumer, callbackURL string) *Service {
+	s.usosAPI = &usosAPIConfig{
+		pending:     pending,
+		consumers:   consumers,
+		callbackURL: callbackURL,
+		httpCli:     &http.Client{Timeout: time.Second * 30},
+	}
+	return s
+}
+
+// usosAPIClient returns the USOS API client for the university, if authorizing through the USOS API is available for it.
+func (s *Service) usosAPIClient(university *universities.University) (*usosapi.Client, bool) {
+	if s.usosAPI == nil || university.USOSAPIURL == "" {
+		return nil, false
+	}
+	consumer, ok := s.usosAPI.consumers[university.ID]
+	if !ok {
+		return nil, false
+	}
+
+	return usosapi.NewClient(s.usosAPI.httpCli, university.USOSAPIURL, consumer), true
+}
+
+// HandleAuthorizeUSOSAPIHTTP starts authorizing through the USOS API, redirecting the user to the USOS API authorization page.
+func (s *Service) HandleAuthorizeUSOSAPIHTTP(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+
+	token := r.PostFormValue("token")
+	university, err := s.universities.Get(r.PostFormValue("university"))
+	if err != nil {
+		s.writeAuthorizePage(token, "Unknown university.", w, r)
+		return
+	}
+	cli, ok := s.usosAPIClient(university)
+	if !ok {
+		s.writeAuthorizePage(token, "Authorizing through USOS isn't available for this university.", w, r)
+		return
+	}
+	if !s.tokenRegexp.MatchString(token) {
+		s.writeAuthorizePage(token, "Invalid token.", w, r)
+		return
+	}
+
+	userID, err := s.tokens.GetUserID(r.Context(), token)
+	if err != nil {
+		s.writeAuthorizePage(token, "Invalid token.", w, r)
+		return
+	}
+	r = r.WithContext(users.WithLogger(r.Context(), userID))
+	log = logger.FromContext(r.Context())
+
+	requestToken, err := cli.RequestToken(r.Context(), s.usosAPI.callbackURL, usosAPIScopes)
+	if err != nil {
+		s.writeAuthorizePage(token, "Couldn't connect to USOS.", w, r)
+		log.Println(err)
+		return
+	}
+
+	err = s.usosAPI.pending.SavePendingAuthorization(r.Context(), requestToken.Token, &credentials.PendingAuthorization{
+		Token:              token,
+		University:         university.ID,
+		RequestTokenSecret: requestToken.Secret,
+		CreatedAt:          time.Now(),
+	})
+	if err != nil {
+		s.writeAuthorizePage(token, "Internal error.", w, r)
+		log.Println(err)
+		return
+	}
+
+	http.Redirect(w, r, cli.AuthorizeURL(requestToken), http.StatusFound)
+}
+
+// HandleUSOSAPICallbackHTTP finishes authorizing through the USOS API, saving the access token instead of the password.
+func (s *Service) HandleUSOSAPICallbackHTTP(w http.ResponseWriter, r *http.Request) {
+	log := logger.FromContext(r.Context())
+
+	if s.usosAPI == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	requestToken := r.URL.Query().Get("oauth_token")
+	verifier := r.URL.Query().Get("oauth_verifier")
+	if requestToken == "" || verifier == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid authorization.")
+		return
+	}
+
+	pending, err := s.usosAPI.pending.TakePendingAuthorization(r.Context(), requestToken)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Authorization expired, please try again.")
+		log.Println(err)
+		return
+	}
+	token := pending.Token
+
+	userID, err := s.tokens.GetUserID(r.Context(), token)
+	if err != nil {
+		s.writeAuthorizePage(token, "Invalid token.", w, r)
+		return
+	}
+	r = r.WithContext(users.WithLogger(r.Context(), userID))
+	log = logger.FromContext(r.Context())
+
+	university, err := s.universities.Get(pending.University)
+	if err != nil {
+		s.writeAuthorizePage(token, "Unknown university.", w, r)
+		return
+	}
+	cli, ok := s.usosAPIClient(university)
+	if !ok {
+		s.writeAuthorizePage(token, "Authorizing through USOS isn't available for this university.", w, r)
+		return
+	}
+
+	accessToken, err := cli.AccessToken(r.Context(), &usosapi.Token{
+		Token:  requestToken,
+		Secret: pending.RequestTokenSecret,
+	}, verifier)
+	if err != nil {
+		s.writeAuthorizePage(token, "Couldn't authorize through USOS.", w, r)
+		log.Println(err)
+		return
+	}
+
+	var user struct {
+		ID string `json:"id"`
+	}
+	err = cli.Call(r.Context(), "services/users/user", url.Values{"fields": {"id"}}, accessToken, &user)
+	if err != nil {
+		s.writeAuthorizePage(token, "Couldn't authorize through USOS.", w, r)
+		log.Println(errors.Wrap(err, "couldn't get USOS user"))
+		return
+	}
+
+	s.saveCredentials(token, userID, &credentials.Credentials{
+		User:              user.ID,
+		AccessToken:       accessToken.Token,
+		AccessTokenSecret: accessToken.Secret,
+		University:        university.ID,
+		LastLogin:         time.Now(),
+	}, w, r)
+}
+
+func (s *Service) GetAccessToken(ctx context.Context, r *credentials.GetAccessTokenRequest) (*credentials.GetAccessTokenResponse, error) {
+	ctx = users.WithLogger(ctx, users.UserID(r.Userid))
+
+	creds, err := s.creds.GetCredentials(ctx, users.UserID(r.Userid))
+	if errors.Cause(err) == credentials.ErrCredentialsNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get credentials")
+	}
+	if !creds.HasAccessToken() {
+		return nil, status.Error(codes.FailedPrecondition, "the user provided their password, use GetSession")
+	}
+	if creds.Stale {
+		return nil, credentials.LoginErrorStatus(errors.Wrap(credentials.ErrInvalidPassword, "access token was rejected, waiting for the user to authorize again"))
+	}
+	university, err := s.universities.Get(creds.University)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get university")
+	}
+
+	return &credentials.GetAccessTokenResponse{
+		Token:       creds.AccessToken,
+		TokenSecret: creds.AccessTokenSecret,
+		University:  university.ID,
+		UsosapiUrl:  university.USOSAPIURL,
+	}, nil
+}
+
+func (s *Service) InvalidateAccessToken(ctx context.Context, r *credentials.InvalidateAccessTokenRequest) (*credentials.InvalidateAccessTokenResponse, error) {
+	userID := users.UserID(r.Userid)
+	ctx = users.WithLogger(ctx, userID)
+
+	creds, err := s.creds.GetCredentials(ctx, userID)
+	if errors.Cause(err) == credentials.ErrCredentialsNotFound {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get credentials")
+	}
+	// The user may have authorized again since the token got rejected.
+	if !creds.HasAccessToken() || creds.AccessToken != r.Token {
+		return &credentials.InvalidateAccessTokenResponse{}, nil
+	}
+
+	// A rejected access token won't work again, unlike a password which may have been rejected by mistake.
+	s.recordInvalidPassword(ctx, userID, 1)
+
+	return &credentials.InvalidateAccessTokenResponse{}, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/events/outbox"
+	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/credentials"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type memoryCredentialsStorage struct {
+	creds  map[users.UserID]*credentials.Credentials
+	events []*outbox.Event
+}
+
+func (s *memoryCredentialsStorage) GetCredentials(ctx context.Context, userID users.UserID) (*credentials.Credentials, error) {
+	creds, ok := s.creds[userID]
+	if !ok {
+		return nil, credentials.ErrCredentialsNotFound
+	}
+	copied := *creds
+	return &copied, nil
+}
+
+func (s *memoryCredentialsStorage) SaveCredentials(ctx context.Context, userID users.UserID, creds *credentials.Credentials, events ...*outbox.Event) error {
+	copied := *creds
+	s.creds[userID] = &copied
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memoryCredentialsStorage) SetLastLogin(ctx context.Context, userID users.UserID, lastLogin time.Time) error {
+	s.creds[userID].LastLogin = lastLogin
+	s.creds[userID].InvalidPasswordFailures = 0
+	return nil
+}
+
+func (s *memoryCredentialsStorage) RecordInvalidPassword(ctx context.Context, userID users.UserID, maxFailures int, events ...*outbox.Event) (bool, error) {
+	creds := s.creds[userID]
+	if creds.Stale {
+		return false, nil
+	}
+	creds.InvalidPasswordFailures++
+	if creds.InvalidPasswordFailures < maxFailures {
+		return false, nil
+	}
+	creds.Stale = true
+	s.events = append(s.events, events...)
+	return true, nil
+}
+
+func TestService_InvalidateAccessToken(t *testing.T) {
+	ctx := context.Background()
+	storage := &memoryCredentialsStorage{creds: map[users.UserID]*credentials.Credentials{
+		"user": {User: "123456", AccessToken: "token", AccessTokenSecret: "secret", University: "uw"},
+	}}
+	s := &Service{
+		creds:                       storage,
+		credentialsInvalidatedTopic: "credentials-invalidated",
+		maxInvalidPasswordFailures:  3,
+	}
+
+	// A token the user has replaced since is ignored.
+	_, err := s.InvalidateAccessToken(ctx, &credentials.InvalidateAccessTokenRequest{Userid: "user", Token: "old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storage.creds["user"].Stale || len(storage.events) != 0 {
+		t.Fatalf("expected an old token to be ignored, got %+v", storage.creds["user"])
+	}
+
+	_, err = s.InvalidateAccessToken(ctx, &credentials.InvalidateAccessTokenRequest{Userid: "user", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !storage.creds["user"].Stale {
+		t.Error("expected the credentials to be marked stale right away")
+	}
+	if len(storage.events) != 1 || storage.events[0].Topic != "credentials-invalidated" {
+		t.Errorf("expected a credentials invalidated event, got %+v", storage.events)
+	}
+
+	_, err = s.GetAccessToken(ctx, &credentials.GetAccessTokenRequest{Userid: "user"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected the rejected token not to be returned anymore, got %v", err)
+	}
+
+	_, err = s.InvalidateAccessToken(ctx, &credentials.InvalidateAccessTokenRequest{Userid: "unknown", Token: "token"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for unknown user, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/kelseyhightower/envconfig"
+	"google.golang.org/api/option"
+
+	"github.com/cube2222/usos-notifier/common/events"
+	"github.com/cube2222/usos-notifier/common/events/transport"
+	"github.com/cube2222/usos-notifier/common/events/transport/cloudpubsub"
+	"github.com/cube2222/usos-notifier/deadletter"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] list|replay\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	config := &deadletter.Config{}
+	envconfig.MustProcess("deadletter", config)
+
+	timeout := flag.Duration("timeout", time.Second*10, "How long to wait for dead lettered messages.")
+	ids := flag.String("ids", "", "Comma separated original message IDs to replay. Replays all messages if empty.")
+	topic := flag.String("topic", "", "Topic to replay the messages to. Defaults to the topic they were originally published to.")
+	keepIdempotencyKey := flag.Bool("keep-idempotency-key", false, "Keep the original idempotency keys, so the messages get deduplicated if they have been handled since.")
+	flag.Usage = usage
+	flag.Parse()
+
+	command := flag.Arg(0)
+	if command != "list" && command != "replay" {
+		usage()
+		os.Exit(2)
+	}
+
+	selected := make(map[string]bool)
+	for _, id := range strings.Split(*ids, ",") {
+		if id != "" {
+			selected[id] = true
+		}
+	}
+
+	var opts []option.ClientOption
+	if config.GoogleApplicationCredentials != "" {
+		opts = append(opts, option.WithCredentialsFile(config.GoogleApplicationCredentials))
+	}
+	pubsubCli, err := pubsub.NewClient(context.Background(), config.ProjectName, opts...)
+	if err != nil {
+		log.Fatal("Couldn't create pubsub client: ", err)
+	}
+	pubsubTransport := cloudpubsub.NewTransport(pubsubCli)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	mutex := sync.Mutex{}
+	// Nacked messages get redelivered, we only want to handle each once.
+	seen := make(map[string]bool)
+
+	err = pubsubTransport.Receive(ctx, config.DeadLetterSubscription, transport.ReceiveSettings{}, func(ctx context.Context, msg *transport.Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if seen[msg.ID] {
+			msg.Nack()
+			return
+		}
+		seen[msg.ID] = true
+
+		entry := deadletter.ParseEntry(msg)
+
+		if command == "list" || (len(selected) > 0 && !selected[entry.MessageID]) {
+			printEntry(entry)
+			msg.Nack()
+			return
+		}
+
+		target := entry.SourceTopic
+		if *topic != "" {
+			target = *topic
+		}
+		if target == "" {
+			log.Printf("Not replaying message %v, unknown source topic.", entry.MessageID)
+			msg.Nack()
+			return
+		}
+
+		attributes, err := entry.ReplayAttributes(*keepIdempotencyKey)
+		if err != nil {
+			log.Printf("Couldn't replay message %v: %v", entry.MessageID, err)
+			msg.Nack()
+			return
+		}
+		err = pubsubTransport.Declare(ctx, target)
+		if err != nil {
+			log.Printf("Couldn't declare topic %v: %v", target, err)
+			msg.Nack()
+			return
+		}
+		_, err = pubsubTransport.Publish(ctx, target, entry.Data, attributes)
+		if err != nil {
+			log.Printf("Couldn't replay message %v: %v", entry.MessageID, err)
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+		log.Printf("Replayed message %v to %v for %v.", entry.MessageID, target, entry.Handler)
+	})
+	if err != nil {
+		log.Fatal("Couldn't receive dead lettered messages: ", err)
+	}
+}
+
+func printEntry(entry *deadletter.Entry) {
+	data, err := events.DecodePayload(entry.Data, entry.Attributes)
+	if err != nil {
+		data = entry.Data
+	}
+
+	fmt.Printf("Message %v\n", entry.MessageID)
+	fmt.Printf("\tTopic: %v\n", entry.SourceTopic)
+	fmt.Printf("\tHandler: %v\n", entry.Handler)
+	fmt.Printf("\tDelivery attempt: %v\n", entry.DeliveryAttempt)
+	fmt.Printf("\tTime: %v\n", entry.Time)
+	fmt.Printf("\tError: %v\n", entry.Error)
+	fmt.Printf("\tAttributes: %v\n", entry.Attributes)
+	fmt.Printf("\tData: %s\n", data)
+}
@@ -0,0 +1,7 @@
+package deadletter
+
+type Config struct {
+	ProjectName                  string `default:"usos-notifier" split_words:"true"`
+	DeadLetterSubscription       string `default:"deadletter-dead_letter" split_words:"true"`
+	GoogleApplicationCredentials string `default:"/var/secrets/google/serviceaccount.json" split_words:"true"`
+}
@@ -0,0 +1,50 @@
+package deadletter
+
+import (
+	"strings"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+// Entry is a message which has been republished to the dead letter topic by subscriber.WithDeadLetter.
+type Entry struct {
+	MessageID       string
+	SourceTopic     string
+	Handler         string
+	DeliveryAttempt string
+	Error           string
+	Time            string
+
+	// Data and Attributes are the ones of the original message.
+	Data       []byte
+	Attributes map[string]string
+}
+
+// ReplayAttributes returns the attributes to replay the message with.
+// The message is published to the source topic again, but only the handler which failed handles it.
+// It gets a new idempotency key, unless keepIdempotencyKey is set, as the failed message has been marked as handled.
+func (e *Entry) ReplayAttributes(keepIdempotencyKey bool) (map[string]string, error) {
+	return subscriber.ReplayAttributes(e.Attributes, e.Handler, keepIdempotencyKey)
+}
+
+func ParseEntry(msg *transport.Message) *Entry {
+	attributes := make(map[string]string)
+	for key, value := range msg.Attributes {
+		if !strings.HasPrefix(key, "dead_letter_") {
+			attributes[key] = value
+		}
+	}
+
+	return &Entry{
+		MessageID:       msg.Attributes[subscriber.DeadLetterMessageIDKey],
+		SourceTopic:     msg.Attributes[publisher.TopicKey],
+		Handler:         msg.Attributes[subscriber.DeadLetterHandlerKey],
+		DeliveryAttempt: msg.Attributes[subscriber.DeadLetterDeliveryAttemptKey],
+		Error:           msg.Attributes[subscriber.DeadLetterErrorKey],
+		Time:            msg.Attributes[subscriber.DeadLetterTimeKey],
+		Data:            msg.Data,
+		Attributes:      attributes,
+	}
+}
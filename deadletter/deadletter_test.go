@@ -0,0 +1,84 @@
+package deadletter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	"github.com/cube2222/usos-notifier/common/events/transport"
+)
+
+type deadLetterTopic struct {
+	msgs []*transport.Message
+}
+
+func (t *deadLetterTopic) Publish(ctx context.Context, topic string, data []byte, attributes map[string]string) (string, error) {
+	t.msgs = append(t.msgs, transport.NewMessage("dead", data, attributes, 1, func() {}, func() {}))
+	return "dead", nil
+}
+
+func TestReplay(t *testing.T) {
+	deadLetters := &deadLetterTopic{}
+	calls := 0
+	fail := true
+	handler := subscriber.Chain(
+		func(ctx context.Context, msg *subscriber.Message) error {
+			calls++
+			if fail {
+				return subscriber.NewNonRetryableError(errors.New("broken"))
+			}
+			return nil
+		},
+		subscriber.WithDeduplication(subscriber.NewMemorySeenStore(10), "test.Handler"),
+		subscriber.WithDeadLetter(deadLetters, "dead_letter", "test.Handler"),
+	)
+
+	err := handler(context.Background(), &subscriber.Message{
+		ID:   "1",
+		Data: []byte("data"),
+		Attributes: map[string]string{
+			publisher.IdempotencyKey: "abc",
+			publisher.TopicKey:       "source",
+		},
+	})
+	if !subscriber.IsNonRetryableError(err) {
+		t.Fatalf("expected permanent error, got %v", err)
+	}
+	if len(deadLetters.msgs) != 1 {
+		t.Fatalf("dead lettered %d messages, want 1", len(deadLetters.msgs))
+	}
+
+	entry := ParseEntry(deadLetters.msgs[0])
+	if entry.SourceTopic != "source" || entry.Handler != "test.Handler" {
+		t.Errorf("entry topic = %v, handler = %v", entry.SourceTopic, entry.Handler)
+	}
+
+	fail = false
+	attributes, err := entry.ReplayAttributes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = handler(context.Background(), &subscriber.Message{ID: "2", Data: entry.Data, Attributes: attributes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+
+	// With the original idempotency key the replayed message counts as already handled.
+	attributes, err = entry.ReplayAttributes(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = handler(context.Background(), &subscriber.Message{ID: "3", Data: entry.Data, Attributes: attributes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
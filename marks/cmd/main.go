@@ -8,15 +8,21 @@ import (
 	"cloud.google.com/go/pubsub"
 	"github.com/cube2222/grpc-utils/health"
 	"github.com/cube2222/grpc-utils/logger"
-	"github.com/cube2222/grpc-utils/requestid"
 	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/events/recording"
 	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	subscriberdatastore "github.com/cube2222/usos-notifier/common/events/subscriber/datastore"
+	"github.com/cube2222/usos-notifier/common/events/transport/cloudpubsub"
+	"github.com/cube2222/usos-notifier/common/lifecycle"
+	"github.com/cube2222/usos-notifier/common/metrics"
+	"github.com/cube2222/usos-notifier/common/tracing"
 	"github.com/cube2222/usos-notifier/credentials"
 	"github.com/cube2222/usos-notifier/marks"
 	"github.com/cube2222/usos-notifier/marks/service"
 	"github.com/cube2222/usos-notifier/marks/service/datastore"
 	"github.com/cube2222/usos-notifier/notifier"
 	"github.com/kelseyhightower/envconfig"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 )
@@ -33,64 +39,137 @@ func main() {
 	if err != nil {
 		log.Fatal("Couldn't create pubsub client", err)
 	}
+	pubsubTransport := cloudpubsub.
+		NewTransport(pubsubCli).
+		WithBatching(cloudpubsub.BatchSettings{
+			CountThreshold: config.PublishBatchCount,
+			ByteThreshold:  config.PublishBatchBytes,
+			DelayThreshold: config.PublishBatchDelay,
+		})
+	err = pubsubTransport.Declare(context.Background(), config.NotificationsTopic, config.DeadLetterTopic)
+	if err != nil {
+		log.Fatal("Couldn't declare pubsub topics: ", err)
+	}
+
+	lc := lifecycle.New(config.ShutdownTimeout)
+	shutdownTracing, err := tracing.Init("marks", config.TracingExporter, config.TracingFile)
+	if err != nil {
+		log.Fatal("Couldn't set up tracing: ", err)
+	}
+	lc.OnShutdown("tracing", shutdownTracing)
+	lc.OnShutdown("pubsub", func(ctx context.Context) error {
+		pubsubTransport.Stop()
+		return pubsubCli.Close()
+	})
+
+	recorder, err := recording.NewFileRecorder(config.RecordingFile, config.RecordingMaxSize, config.RecordingMaxFiles)
+	if err != nil {
+		log.Fatal("Couldn't create event recorder: ", err)
+	}
+	lc.OnShutdown("recorder", func(ctx context.Context) error {
+		return recorder.Close()
+	})
+	chainDeps := subscriber.ChainDeps{
+		Logger:          logger.NewStdLogger(),
+		Recorder:        recorder,
+		SeenStore:       subscriberdatastore.NewSeenStore(ds, config.DeduplicationRetention),
+		DeadLetter:      pubsubTransport,
+		DeadLetterTopic: config.DeadLetterTopic,
+		Retry: subscriber.RetryConfig{
+			MaxAttempts:    config.MaxDeliveryAttempts,
+			InitialBackoff: config.RetryInitialBackoff,
+			MaxBackoff:     config.RetryMaxBackoff,
+		},
+	}
 
-	conn, err := grpc.Dial(config.CredentialsAddress, grpc.WithInsecure())
+	conn, err := grpc.Dial(
+		config.CredentialsAddress,
+		grpc.WithInsecure(),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
 	if err != nil {
 		log.Fatal(err)
 	}
 	credentialsCli := credentials.NewCredentialsClient(conn)
 	userStorage := datastore.NewUserStorage(ds)
 	pub := publisher.
-		NewPublisher(pubsubCli).
-		Use(publisher.WithRequestID)
+		NewPublisher(pubsubTransport).
+		WithContentEncoding(config.PublishContentEncoding).
+		Use(publisher.WithRequestID).
+		Use(publisher.WithTracing).
+		Use(publisher.WithMetrics)
+	lc.OnShutdown("publisher", pub.Stop)
 	notificationSender := notifier.NewNotificationSender(
 		pub,
 		config.NotificationsTopic,
 	)
 
-	s := service.NewService(credentialsCli, notificationSender, userStorage)
+	usosAPIConsumers, err := config.UsosApiConsumers()
+	if err != nil {
+		log.Fatal("Couldn't get USOS API consumers: ", err)
+	}
+	s := service.
+		NewService(credentialsCli, notificationSender, userStorage, config.AccessTokenCacheTTL).
+		WithUSOSAPI(usosAPIConsumers)
 
 	// Set up user message event subscription
-	go func() {
-		log.Fatal(
-			subscriber.
-				NewSubscriptionClient(pubsubCli).
-				Subscribe(
-					context.Background(),
-					config.CommandsSubscription,
-					subscriber.Chain(
-						s.HandleUserMessageEvent,
-						subscriber.WithLogger(logger.NewStdLogger()),
-						subscriber.WithRequestID,
-						subscriber.WithLogging(requestid.Key),
-					),
-				),
-		)
-	}()
+	lc.Go("commands subscription", func(ctx context.Context) error {
+		return subscriber.
+			NewSubscriptionClient(pubsubTransport).
+			WithReceiveSettings(config.CommandsFlowControl.ReceiveSettings()).
+			SubscribeTyped(
+				ctx,
+				config.CommandsSubscription,
+				notifier.UserCommandEventName,
+				s.HandleUserMessageEvent,
+				subscriber.DefaultChain("marks.HandleUserMessageEvent", chainDeps, config.CommandsFlowControl.MaxConcurrentHandlers)...,
+			)
+	})
 	log.Printf("Subscribed to %s", config.CommandsSubscription)
 
 	// Set up credentials received event subscription
-	go func() {
-		log.Fatal(
-			subscriber.
-				NewSubscriptionClient(pubsubCli).
-				Subscribe(
-					context.Background(),
-					config.CredentialsReceivedSubscription,
-					subscriber.Chain(
-						s.HandleCredentialsProvidedEvent,
-						subscriber.WithLogger(logger.NewStdLogger()),
-						subscriber.WithRequestID,
-						subscriber.WithLogging(requestid.Key),
-					),
-				),
-		)
-	}()
+	lc.Go("credentials received subscription", func(ctx context.Context) error {
+		return subscriber.
+			NewSubscriptionClient(pubsubTransport).
+			WithReceiveSettings(config.CredentialsReceivedFlowControl.ReceiveSettings()).
+			SubscribeTyped(
+				ctx,
+				config.CredentialsReceivedSubscription,
+				credentials.CredentialsReceivedEventName,
+				s.HandleCredentialsProvidedEvent,
+				subscriber.DefaultChain("marks.HandleCredentialsProvidedEvent", chainDeps, config.CredentialsReceivedFlowControl.MaxConcurrentHandlers)...,
+			)
+	})
 	log.Printf("Subscribed to %s", config.CredentialsReceivedSubscription)
 
-	go s.RunScoreChecker(context.Background())
+	// Set up credentials invalidated event subscription
+	lc.Go("credentials invalidated subscription", func(ctx context.Context) error {
+		return subscriber.
+			NewSubscriptionClient(pubsubTransport).
+			WithReceiveSettings(config.CredentialsInvalidatedFlowControl.ReceiveSettings()).
+			SubscribeTyped(
+				ctx,
+				config.CredentialsInvalidatedSubscription,
+				credentials.CredentialsInvalidatedEventName,
+				s.HandleCredentialsInvalidatedEvent,
+				subscriber.DefaultChain("marks.HandleCredentialsInvalidatedEvent", chainDeps, config.CredentialsInvalidatedFlowControl.MaxConcurrentHandlers)...,
+			)
+	})
+	log.Printf("Subscribed to %s", config.CredentialsInvalidatedSubscription)
+
+	lc.Go("score checker", func(ctx context.Context) error {
+		s.RunScoreChecker(ctx)
+		return nil
+	})
 	log.Println("Running score checker.")
 
+	lc.ServeHTTP("metrics server", metrics.NewServer(config.ListenPortMetrics))
+
 	// Set up health checking
-	health.LaunchHealthCheckHandler()
+	go health.LaunchHealthCheckHandler()
+
+	err = lc.Wait()
+	if err != nil {
+		log.Fatal(err)
+	}
 }
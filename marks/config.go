@@ -1,10 +1,57 @@
 package marks
 
+import (
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	"github.com/cube2222/usos-notifier/common/usosapi"
+)
+
 type Config struct {
-	ProjectName                     string `default:"usos-notifier" split_words:"true"`
-	CredentialsAddress              string `default:"credentials:8081" split_words:"true"`
-	CredentialsReceivedSubscription string `default:"marks-credentials-credentials_received" split_words:"true"`
-	NotificationsTopic              string `default:"notifications" split_words:"true"`
-	CommandsSubscription            string `default:"marks-notifier-commands" split_words:"true"`
-	GoogleApplicationCredentials    string `default:"/var/secrets/google/serviceaccount.json" split_words:"true"`
+	ListenPortMetrics int `default:"9090" split_words:"true"`
+
+	ProjectName                        string `default:"usos-notifier" split_words:"true"`
+	CredentialsAddress                 string `default:"credentials:8081" split_words:"true"`
+	CredentialsReceivedSubscription    string `default:"marks-credentials-credentials_received" split_words:"true"`
+	CredentialsInvalidatedSubscription string `default:"marks-credentials-credentials_invalidated" split_words:"true"`
+	NotificationsTopic                 string `default:"notifications" split_words:"true"`
+	DeadLetterTopic                    string `default:"dead_letter" split_words:"true"`
+	CommandsSubscription               string `default:"marks-notifier-commands" split_words:"true"`
+	GoogleApplicationCredentials       string `default:"/var/secrets/google/serviceaccount.json" split_words:"true"`
+
+	// The USOS API is used for users who authorized through it, with the consumer key and secret of their university,
+	// keyed by university ID, e.g. "uw:key,mimuw:key". The same ones as configured for the credentials service.
+	UsosApiConsumerKeys    map[string]string `split_words:"true"`
+	UsosApiConsumerSecrets map[string]string `split_words:"true"`
+	AccessTokenCacheTTL    time.Duration     `default:"10m" split_words:"true"`
+
+	MaxDeliveryAttempts    int           `default:"5" split_words:"true"`
+	RetryInitialBackoff    time.Duration `default:"1s" split_words:"true"`
+	RetryMaxBackoff        time.Duration `default:"1m" split_words:"true"`
+	DeduplicationRetention time.Duration `default:"168h" split_words:"true"`
+	ShutdownTimeout        time.Duration `default:"25s" split_words:"true"`
+
+	PublishBatchCount int           `default:"100" split_words:"true"`
+	PublishBatchBytes int           `default:"1000000" split_words:"true"`
+	PublishBatchDelay time.Duration `default:"10ms" split_words:"true"`
+
+	// PublishContentEncoding is base64 or raw, switch to raw only once all subscribers of the topics are upgraded.
+	PublishContentEncoding string `default:"base64" split_words:"true"`
+
+	CommandsFlowControl               subscriber.FlowControlConfig `split_words:"true"`
+	CredentialsReceivedFlowControl    subscriber.FlowControlConfig `split_words:"true"`
+	CredentialsInvalidatedFlowControl subscriber.FlowControlConfig `split_words:"true"`
+
+	TracingExporter string `default:"none" split_words:"true"`
+	TracingFile     string `default:"traces.json" split_words:"true"`
+
+	// Handled events are recorded to RecordingFile if it's set, for debugging with the replay tool.
+	RecordingFile     string `split_words:"true"`
+	RecordingMaxSize  int64  `default:"104857600" split_words:"true"`
+	RecordingMaxFiles int    `default:"5" split_words:"true"`
+}
+
+// UsosApiConsumers returns the USOS API consumers by university ID.
+func (c *Config) UsosApiConsumers() (map[string]usosapi.Consumer, error) {
+	return usosapi.Consumers(c.UsosApiConsumerKeys, c.UsosApiConsumerSecrets)
 }
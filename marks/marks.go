@@ -16,6 +16,8 @@ type User struct {
 	ObservedClasses  []ClassHeader
 	Classes          []Class
 	NextCheck        time.Time
+	// Paused users aren't checked until they provide new credentials, as the old ones stopped working.
+	Paused bool
 }
 
 type ClassHeader struct {
@@ -41,6 +43,9 @@ func (s *Score) Visible() bool {
 
 type UserStorage interface {
 	Get(ctx context.Context, userID users.UserID) (*User, error)
+	// Set saves the user, but keeps the stored Paused, which is only changed by SetPaused.
 	Set(ctx context.Context, userID users.UserID, user *User) error
+	// SetPaused returns ErrUserNotFound for users who haven't been initialized yet.
+	SetPaused(ctx context.Context, userID users.UserID, paused bool) error
 	HandleNextCheck(ctx context.Context) (users.UserID, *User, error)
 }
@@ -1,8 +1,8 @@
 package parser
 
 import (
+	"fmt"
 	"io"
-	"log"
 	"regexp"
 
 	"github.com/PuerkitoBio/goquery"
@@ -16,12 +16,13 @@ type Class struct {
 
 var idRegexp = regexp.MustCompile("[0-9]+")
 
-func GetClasses(r io.Reader) (map[string]*Class, error) {
+// GetClasses finds the classes on the USOSweb home page, usoswebURL is the base URL of the USOSweb.
+func GetClasses(r io.Reader, usoswebURL string) (map[string]*Class, error) {
 	doc, err := goquery.NewDocumentFromReader(r)
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't parse html")
 	}
-	selection := doc.Find("[href^=\"https://usosweb.mimuw.edu.pl/kontroler.php?_action=dla_stud/studia/sprawdziany/pokaz\"]")
+	selection := doc.Find(fmt.Sprintf("[href^=%q]", usoswebURL+"/kontroler.php?_action=dla_stud/studia/sprawdziany/pokaz"))
 
 	classes := map[string]*Class{}
 	for _, node := range selection.Nodes {
@@ -31,7 +32,6 @@ func GetClasses(r io.Reader) (map[string]*Class, error) {
 		}
 		classes[id] = class
 	}
-	log.Printf("%+v", classes)
 
 	return classes, nil
 }
@@ -45,7 +45,7 @@ func TestGetClasses(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			got, err := GetClasses(f)
+			got, err := GetClasses(f, "https://usosweb.mimuw.edu.pl")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetClasses() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/credentials"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errNoAccessToken is returned for users who provided their password instead of authorizing through the USOS API.
+var errNoAccessToken = errors.New("user provided their password")
+
+type cachedAccessToken struct {
+	// token is nil for users who provided their password.
+	token   *credentials.GetAccessTokenResponse
+	expires time.Time
+}
+
+// accessTokenCache caches the USOS API access tokens per user, so not every check has to get them
+// from the credentials service, which reads and decrypts the stored credentials each time.
+type accessTokenCache struct {
+	ttl time.Duration
+	get func(ctx context.Context, userID users.UserID) (*credentials.GetAccessTokenResponse, error)
+
+	mu     sync.Mutex
+	tokens map[users.UserID]cachedAccessToken
+	// generations are bumped by Invalidate, tokens got before that aren't cached.
+	generations map[users.UserID]uint64
+}
+
+func newAccessTokenCache(ttl time.Duration, get func(ctx context.Context, userID users.UserID) (*credentials.GetAccessTokenResponse, error)) *accessTokenCache {
+	return &accessTokenCache{
+		ttl:         ttl,
+		get:         get,
+		tokens:      make(map[users.UserID]cachedAccessToken),
+		generations: make(map[users.UserID]uint64),
+	}
+}
+
+// Get returns the access token of the user, or errNoAccessToken if they provided their password.
+func (c *accessTokenCache) Get(ctx context.Context, userID users.UserID) (*credentials.GetAccessTokenResponse, error) {
+	c.mu.Lock()
+	cached, ok := c.tokens[userID]
+	generation := c.generations[userID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cachedTokenOrError(cached.token)
+	}
+
+	token, err := c.get(ctx, userID)
+	// The user provided their password, or the credentials service doesn't support the USOS API yet.
+	if code := status.Code(err); code == codes.FailedPrecondition || code == codes.Unimplemented {
+		token, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.generations[userID] == generation {
+		c.tokens[userID] = cachedAccessToken{
+			token:   token,
+			expires: time.Now().Add(c.ttl),
+		}
+	}
+	c.mu.Unlock()
+
+	return cachedTokenOrError(token)
+}
+
+func cachedTokenOrError(token *credentials.GetAccessTokenResponse) (*credentials.GetAccessTokenResponse, error) {
+	if token == nil {
+		return nil, errNoAccessToken
+	}
+	return token, nil
+}
+
+// Invalidate drops the cached access token of the user, after they provided new credentials or the token got rejected.
+func (c *accessTokenCache) Invalidate(userID users.UserID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[userID]++
+	delete(c.tokens, userID)
+}
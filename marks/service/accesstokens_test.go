@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/common/usosapi"
+	"github.com/cube2222/usos-notifier/credentials"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessTokenCache(t *testing.T) {
+	ctx := context.Background()
+	calls := map[users.UserID]int{}
+	cache := newAccessTokenCache(time.Minute, func(ctx context.Context, userID users.UserID) (*credentials.GetAccessTokenResponse, error) {
+		calls[userID]++
+		if userID == "password" {
+			return nil, status.Error(codes.FailedPrecondition, "the user provided their password")
+		}
+		return &credentials.GetAccessTokenResponse{Token: "token"}, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if token, err := cache.Get(ctx, "token"); err != nil || token.Token != "token" {
+			t.Errorf("expected the token, got %v, %v", token, err)
+		}
+		if _, err := cache.Get(ctx, "password"); err != errNoAccessToken {
+			t.Errorf("expected errNoAccessToken, got %v", err)
+		}
+	}
+	if calls["token"] != 1 || calls["password"] != 1 {
+		t.Errorf("expected the results to be cached, got %v calls", calls)
+	}
+
+	cache.Invalidate("token")
+	if _, err := cache.Get(ctx, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if calls["token"] != 2 {
+		t.Errorf("expected the token to be got again after invalidation, got %v calls", calls["token"])
+	}
+}
+
+func TestAccessTokenCache_InvalidateDuringGet(t *testing.T) {
+	ctx := context.Background()
+	var cache *accessTokenCache
+	cache = newAccessTokenCache(time.Minute, func(ctx context.Context, userID users.UserID) (*credentials.GetAccessTokenResponse, error) {
+		// The user authorizes again while the old token is being got.
+		cache.Invalidate(userID)
+		return &credentials.GetAccessTokenResponse{Token: "old"}, nil
+	})
+
+	if _, err := cache.Get(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.tokens["user"]; ok {
+		t.Error("expected the token got before invalidation not to be cached")
+	}
+}
+
+type fakeCredentialsClient struct {
+	credentials.CredentialsClient
+	invalidated []*credentials.InvalidateAccessTokenRequest
+}
+
+func (c *fakeCredentialsClient) InvalidateAccessToken(ctx context.Context, in *credentials.InvalidateAccessTokenRequest, opts ...grpc.CallOption) (*credentials.InvalidateAccessTokenResponse, error) {
+	c.invalidated = append(c.invalidated, in)
+	return &credentials.InvalidateAccessTokenResponse{}, nil
+}
+
+func TestInvalidateExpiredSession_RejectedAccessToken(t *testing.T) {
+	ctx := context.Background()
+	cli := &fakeCredentialsClient{}
+	s := &Service{credentials: cli}
+	s.accessTokens = newAccessTokenCache(time.Minute, func(ctx context.Context, userID users.UserID) (*credentials.GetAccessTokenResponse, error) {
+		return &credentials.GetAccessTokenResponse{Token: "token"}, nil
+	})
+	if _, err := s.accessTokens.Get(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	u := &usosAPI{token: &usosapi.Token{Token: "token", Secret: "secret"}}
+	s.invalidateExpiredSession(ctx, "user", u, errors.Wrap(credentials.ErrInvalidPassword, "couldn't get classes"))
+
+	if _, ok := s.accessTokens.tokens["user"]; ok {
+		t.Error("expected the rejected token to be dropped from the cache")
+	}
+	if len(cli.invalidated) != 1 || cli.invalidated[0].Userid != "user" || cli.invalidated[0].Token != "token" {
+		t.Errorf("expected the rejected token to be reported to the credentials service, got %+v", cli.invalidated)
+	}
+
+	// Other errors aren't reported.
+	s.invalidateExpiredSession(ctx, "user", u, credentials.ErrCASUnavailable)
+	if len(cli.invalidated) != 1 {
+		t.Errorf("expected only the rejected token to be reported, got %+v", cli.invalidated)
+	}
+}
@@ -34,17 +34,50 @@ func (s *userStorage) Get(ctx context.Context, userID users.UserID) (*marks.User
 	return out, nil
 }
 
-func (s *userStorage) Set(ctx context.Context, userID users.UserID, user *marks.User) (err error) {
+func (s *userStorage) Set(ctx context.Context, userID users.UserID, user *marks.User) error {
 	key := datastore.NameKey("scores", userID.String(), nil)
-	_, err = s.ds.Put(ctx, key, user)
-	return
+	_, err := s.ds.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		saved := *user
+		existing := &marks.User{}
+		err := tx.Get(key, existing)
+		switch {
+		case err == nil:
+			// The user may have been paused since they were read.
+			saved.Paused = existing.Paused
+		case err != datastore.ErrNoSuchEntity:
+			return errors.Wrap(err, "couldn't get existing user")
+		}
+
+		_, err = tx.Put(key, &saved)
+		return err
+	})
+	return err
+}
+
+func (s *userStorage) SetPaused(ctx context.Context, userID users.UserID, paused bool) error {
+	key := datastore.NameKey("scores", userID.String(), nil)
+	_, err := s.ds.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		user := &marks.User{}
+		err := tx.Get(key, user)
+		if err != nil {
+			if err == datastore.ErrNoSuchEntity {
+				return marks.ErrUserNotFound
+			}
+			return errors.Wrap(err, "couldn't get user")
+		}
+
+		user.Paused = paused
+		_, err = tx.Put(key, user)
+		return err
+	})
+	return err
 }
 
 func (s *userStorage) HandleNextCheck(ctx context.Context) (users.UserID, *marks.User, error) {
 	var out []*marks.User
 
 	query := datastore.NewQuery("scores").Filter("NextCheck <", time.Now()).Limit(1)
-	keys, err := s.ds.GetAll(context.Background(), query, &out)
+	keys, err := s.ds.GetAll(ctx, query, &out)
 	if err != nil {
 		return "", nil, errors.Wrap(err, "couldn't get user for query")
 	}
@@ -58,7 +91,7 @@ func (s *userStorage) HandleNextCheck(ctx context.Context) (users.UserID, *marks
 	}
 	defer tx.Rollback()
 
-	err = s.ds.Get(ctx, keys[0], out[0])
+	err = tx.Get(keys[0], out[0])
 	if err != nil {
 		return "", nil, errors.Wrap(err, "couldn't get user to check if still eligible")
 	}
@@ -0,0 +1,55 @@
+package datastore
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/marks"
+)
+
+// TestUserStorage_Paused needs the Datastore emulator, see gcloud beta emulators datastore.
+func TestUserStorage_Paused(t *testing.T) {
+	if os.Getenv("DATASTORE_EMULATOR_HOST") == "" {
+		t.Skip("DATASTORE_EMULATOR_HOST not set")
+	}
+	ctx := context.Background()
+
+	ds, err := datastore.NewClient(ctx, "usos-notifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	storage := NewUserStorage(ds)
+	userID := users.NewUserID("paused-test")
+	if err := storage.SetPaused(ctx, userID, true); err != marks.ErrUserNotFound {
+		t.Errorf("expected ErrUserNotFound for a new user, got %v", err)
+	}
+	if err := storage.Set(ctx, userID, &marks.User{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The credentials get invalidated while the user is being checked.
+	checked, err := storage.Get(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.SetPaused(ctx, userID, true); err != nil {
+		t.Fatal(err)
+	}
+	checked.Classes = []marks.Class{{ClassHeader: marks.ClassHeader{ID: "1"}}}
+	if err := storage.Set(ctx, userID, checked); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := storage.Get(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.Paused || len(user.Classes) != 1 {
+		t.Errorf("expected the scores to be saved and the user to stay paused, got %+v", user)
+	}
+}
@@ -7,14 +7,23 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/cube2222/usos-notifier/common/tracing"
 	"github.com/cube2222/usos-notifier/marks/parser"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func getAuthorizedWebsite(ctx context.Context, httpCli *http.Client, session, path string) (io.ReadCloser, error) {
+// usosSession is a USOSweb session of a user, together with the USOSweb of their university.
+type usosSession struct {
+	ID         string
+	USOSwebURL string
+}
+
+func getAuthorizedWebsite(ctx context.Context, httpCli *http.Client, session *usosSession, path string) (io.ReadCloser, error) {
 	req, err := http.NewRequest(
 		http.MethodGet,
-		fmt.Sprintf("%s%s", "https://usosweb.mimuw.edu.pl", path),
+		fmt.Sprintf("%s%s", session.USOSwebURL, path),
 		nil,
 	)
 	if err != nil {
@@ -26,9 +35,9 @@ func getAuthorizedWebsite(ctx context.Context, httpCli *http.Client, session, pa
 	req.AddCookie(
 		&http.Cookie{
 			Name:     "PHPSESSID",
-			Value:    session,
+			Value:    session.ID,
 			Path:     "/",
-			Domain:   "usosweb.mimuw.edu.pl",
+			Domain:   req.URL.Hostname(),
 			HttpOnly: true,
 
 			Expires: time.Now().Add(time.Minute * 15),
@@ -52,14 +61,29 @@ func getAuthorizedWebsite(ctx context.Context, httpCli *http.Client, session, pa
 	return res.Body, nil
 }
 
-func getClasses(ctx context.Context, httpCli *http.Client, session string) (map[string]*parser.Class, error) {
+func scrapeSpanOptions(page string) []trace.SpanStartOption {
+	return []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("usos.page", page)),
+	}
+}
+
+func getClasses(ctx context.Context, httpCli *http.Client, session *usosSession) (_ map[string]*parser.Class, err error) {
+	defer func(start time.Time) {
+		observeUSOSScrape("classes", start, err)
+	}(time.Now())
+	ctx, span := tracing.StartSpan(ctx, "usos.scrape", scrapeSpanOptions("classes")...)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	body, err := getAuthorizedWebsite(ctx, httpCli, session, "/kontroler.php?_action=home/index")
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't get authorized website")
 	}
 	defer body.Close()
 
-	classes, err := parser.GetClasses(body)
+	classes, err := parser.GetClasses(body, session.USOSwebURL)
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't get classes")
 	}
@@ -67,7 +91,15 @@ func getClasses(ctx context.Context, httpCli *http.Client, session string) (map[
 	return classes, nil
 }
 
-func getScoresForClass(ctx context.Context, httpCli *http.Client, session, classId string) (map[string]*parser.Score, error) {
+func getScoresForClass(ctx context.Context, httpCli *http.Client, session *usosSession, classId string) (_ map[string]*parser.Score, err error) {
+	defer func(start time.Time) {
+		observeUSOSScrape("scores", start, err)
+	}(time.Now())
+	ctx, span := tracing.StartSpan(ctx, "usos.scrape", scrapeSpanOptions("scores")...)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	body, err := getAuthorizedWebsite(
 		ctx,
 		httpCli,
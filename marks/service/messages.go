@@ -3,18 +3,17 @@ package service
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"sort"
 	"strings"
 
 	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/credentials"
 	"github.com/cube2222/usos-notifier/marks"
 	"github.com/cube2222/usos-notifier/marks/parser"
 	"github.com/pkg/errors"
 )
 
 func (s *Service) SubscribeClass(ctx context.Context, userID users.UserID, params map[string]string) (string, error) {
-	httpCli := &http.Client{}
 	classID := params["class_id"]
 
 	user, err := s.users.Get(ctx, userID)
@@ -29,9 +28,12 @@ func (s *Service) SubscribeClass(ctx context.Context, userID users.UserID, param
 		}
 	}
 
-	session, err := s.getSession(ctx, userID)
+	u, err := s.getUSOS(ctx, userID)
+	if reply, ok := loginFailureReply(err); ok {
+		return reply, nil
+	}
 	if err != nil {
-		return "", errors.Wrap(err, "couldn't get session")
+		return "", errors.Wrap(err, "couldn't get USOS")
 	}
 
 	// Check if the class is already known to us
@@ -45,8 +47,9 @@ func (s *Service) SubscribeClass(ctx context.Context, userID users.UserID, param
 
 	// Check if this is a class that is available, but we don't know about it yet
 	if found == nil {
-		classes, err := getClasses(ctx, httpCli, session)
+		classes, err := u.classes(ctx)
 		if err != nil {
+			s.invalidateExpiredSession(ctx, userID, u, err)
 			return "", errors.Wrap(err, "couldn't get classes")
 		}
 		user.AvailableClasses = make([]marks.ClassHeader, 0)
@@ -71,8 +74,9 @@ func (s *Service) SubscribeClass(ctx context.Context, userID users.UserID, param
 		return "No class with this ID is available.", nil
 	}
 
-	scores, err := getScoresForClass(ctx, httpCli, session, found.ID)
+	scores, err := u.scoresForClass(ctx, found.ID)
 	if err != nil {
+		s.invalidateExpiredSession(ctx, userID, u, err)
 		return "", errors.Wrap(err, "couldn't get scores for class")
 	}
 
@@ -159,3 +163,16 @@ func (s *Service) ListClasses(ctx context.Context, userID users.UserID, params m
 
 	return strings.Join(lines, "\n"), nil
 }
+
+// loginFailureReply tells the user why logging into USOS failed, if it's something they should know about.
+func loginFailureReply(err error) (string, bool) {
+	switch errors.Cause(err) {
+	case credentials.ErrInvalidPassword:
+		return "I couldn't log into USOS with your credentials, please authorize me again.", true
+	case credentials.ErrAccountLocked:
+		return "Your USOS account is locked, please unlock it and try again.", true
+	case credentials.ErrCASUnavailable:
+		return "USOS is unavailable right now, please try again later.", true
+	}
+	return "", false
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/cube2222/usos-notifier/common/metrics"
+	"github.com/cube2222/usos-notifier/credentials"
+)
+
+var (
+	usosScrapes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "usos_scrapes_total",
+			Help: "Number of USOS pages scraped, by page and outcome.",
+		},
+		[]string{"page", "outcome"},
+	)
+	usosScrapeDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "usos_scrape_duration_seconds",
+			Help:    "Time it took to get and parse USOS pages, by page.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"page"},
+	)
+)
+
+func observeUSOSScrape(page string, start time.Time, err error) {
+	outcome := metrics.Outcome(err)
+	if errors.Cause(err) == ErrSessionExpired {
+		outcome = "session_expired"
+	}
+
+	usosScrapeDuration.WithLabelValues(page).Observe(time.Since(start).Seconds())
+	usosScrapes.WithLabelValues(page, outcome).Inc()
+}
+
+var (
+	usosAPICalls = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "usos_api_calls_total",
+			Help: "Number of USOS API calls, by method and outcome.",
+		},
+		[]string{"method", "outcome"},
+	)
+	usosAPICallDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "usos_api_call_duration_seconds",
+			Help:    "Time it took to call the USOS API, by method.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+)
+
+func observeUSOSAPICall(method string, start time.Time, err error) {
+	outcome := metrics.Outcome(err)
+	if errors.Cause(err) == credentials.ErrInvalidPassword {
+		outcome = "unauthorized"
+	}
+
+	usosAPICallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	usosAPICalls.WithLabelValues(method, outcome).Inc()
+}
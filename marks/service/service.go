@@ -3,15 +3,17 @@ package service
 import (
 	"context"
 	"fmt"
-	"net/http"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/cube2222/grpc-utils/logger"
+	"github.com/cube2222/usos-notifier/common/events/publisher"
 	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	"github.com/cube2222/usos-notifier/common/universities"
 	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/common/usosapi"
 	"github.com/cube2222/usos-notifier/credentials"
 	"github.com/cube2222/usos-notifier/marks"
 	"github.com/cube2222/usos-notifier/marks/parser"
@@ -23,19 +25,22 @@ import (
 var ErrSessionExpired = errors.New("session expired")
 
 type Service struct {
-	commandsHandler commands.CommandsHandler
-	credentials     credentials.CredentialsClient
-	sender          notifier.NotificationSender
-	users           marks.UserStorage
+	commandsHandler  commands.CommandsHandler
+	credentials      credentials.CredentialsClient
+	sender           notifier.NotificationSender
+	users            marks.UserStorage
+	accessTokens     *accessTokenCache
+	usosAPIConsumers map[string]usosapi.Consumer
 }
 
-func NewService(credentials credentials.CredentialsClient, sender notifier.NotificationSender, users marks.UserStorage) *Service {
+func NewService(credentials credentials.CredentialsClient, sender notifier.NotificationSender, users marks.UserStorage, accessTokenTTL time.Duration) *Service {
 	s := &Service{
 		commandsHandler: commands.NewCommandsHandler(sender),
 		credentials:     credentials,
 		sender:          sender,
 		users:           users,
 	}
+	s.accessTokens = newAccessTokenCache(accessTokenTTL, s.getAccessToken)
 
 	s.commandsHandler.Handle(commands.RegexpMatcher(regexp.MustCompile("^[Ss]ubscribe to (?P<class_id>.+)$")), s.SubscribeClass)
 	s.commandsHandler.Handle(commands.RegexpMatcher(regexp.MustCompile("^[Uu]nsubscribe from (?P<class_id>.+)$")), s.UnsubscribeClass)
@@ -44,43 +49,119 @@ func NewService(credentials credentials.CredentialsClient, sender notifier.Notif
 	return s
 }
 
-func (s *Service) HandleUserMessageEvent(ctx context.Context, message *subscriber.Message) error {
-	return s.commandsHandler.HandleMessage(ctx, message)
+// WithUSOSAPI sets the USOS API consumers by university ID, used for users who authorized through the USOS API.
+func (s *Service) WithUSOSAPI(consumers map[string]usosapi.Consumer) *Service {
+	s.usosAPIConsumers = consumers
+	return s
+}
+
+func (s *Service) HandleUserMessageEvent(ctx context.Context, message *subscriber.Message, event interface{}) error {
+	return s.commandsHandler.HandleMessage(ctx, message, event)
 }
 
-func (s *Service) getSession(ctx context.Context, userID users.UserID) (string, error) {
+func (s *Service) getSession(ctx context.Context, userID users.UserID) (*usosSession, error) {
 	res, err := s.credentials.GetSession(ctx, &credentials.GetSessionRequest{
 		Userid: userID.String(),
 	})
 	if err != nil {
-		return "", errors.Wrap(err, "couldn't get session from credentials service")
+		return nil, errors.Wrap(credentials.LoginErrorFromStatus(err), "couldn't get session from credentials service")
+	}
+
+	usoswebURL := res.UsoswebUrl
+	if usoswebURL == "" {
+		// Older credentials services only support the default university.
+		for _, university := range universities.Builtin() {
+			if university.ID == universities.DefaultID {
+				usoswebURL = university.USOSwebURL
+			}
+		}
 	}
 
-	return res.Sessionid, nil
+	return &usosSession{
+		ID:         res.Sessionid,
+		USOSwebURL: usoswebURL,
+	}, nil
+}
+
+// retryableLoginError makes login errors which won't go away by retrying non-retryable.
+func retryableLoginError(err error) error {
+	switch errors.Cause(err) {
+	case credentials.ErrInvalidPassword, credentials.ErrAccountLocked, credentials.ErrPageFormatChanged:
+		return subscriber.NewNonRetryableError(err)
+	}
+	return err
 }
 
-func (s *Service) HandleCredentialsProvidedEvent(ctx context.Context, message *subscriber.Message) error {
-	text, err := subscriber.DecodeTextMessage(message)
+// invalidateExpiredSession makes the credentials service log in again, if err is caused by the session having expired.
+// The operation can then be retried with a new session. A rejected access token is dropped from the cache
+// and reported to the credentials service, which asks the user to authorize again.
+func (s *Service) invalidateExpiredSession(ctx context.Context, userID users.UserID, u usos, err error) {
+	if api, ok := u.(*usosAPI); ok && errors.Cause(err) == credentials.ErrInvalidPassword {
+		s.accessTokens.Invalidate(userID)
+		_, err = s.credentials.InvalidateAccessToken(ctx, &credentials.InvalidateAccessTokenRequest{
+			Userid: userID.String(),
+			Token:  api.token.Token,
+		})
+		if err != nil {
+			logger.FromContext(ctx).Printf("Couldn't invalidate rejected access token: %v", err)
+		}
+		return
+	}
+	scraper, ok := u.(*usoswebScraper)
+	if !ok || errors.Cause(err) != ErrSessionExpired {
+		return
+	}
+
+	_, err = s.credentials.InvalidateSession(ctx, &credentials.InvalidateSessionRequest{
+		Userid:    userID.String(),
+		Sessionid: scraper.session.ID,
+	})
 	if err != nil {
-		return subscriber.NewNonRetryableError(errors.Wrap(err, "couldn't decode text message"))
+		logger.FromContext(ctx).Printf("Couldn't invalidate expired session: %v", err)
 	}
+}
 
-	userID := users.NewUserID(string(text))
+func (s *Service) HandleCredentialsProvidedEvent(ctx context.Context, message *subscriber.Message, e interface{}) error {
+	event, ok := e.(*credentials.CredentialsReceivedEvent)
+	if !ok {
+		return subscriber.NewNonRetryableError(errors.Errorf("unexpected event type %T", e))
+	}
+	userID := event.UserID
+	// The user may have switched between providing their password and authorizing through the USOS API.
+	s.accessTokens.Invalidate(userID)
 
-	session, err := s.getSession(ctx, userID)
+	u, err := s.getUSOS(ctx, userID)
 	if err != nil {
-		return errors.Wrap(err, "couldn't get session")
+		return retryableLoginError(errors.Wrap(err, "couldn't get USOS"))
 	}
 
-	user, err := initializeUser(ctx, session)
+	user, err := initializeUser(ctx, u)
 	if err != nil {
-		return errors.Wrap(err, "couldn't get user")
+		s.invalidateExpiredSession(ctx, userID, u, err)
+		return retryableLoginError(errors.Wrap(err, "couldn't get user"))
+	}
+
+	existing, err := s.users.Get(ctx, userID)
+	if err != nil && errors.Cause(err) != marks.ErrUserNotFound {
+		return errors.Wrap(err, "couldn't get existing user")
+	}
+	authorizedAgain := err == nil
+	if authorizedAgain {
+		// The user authorized again, keep their subscriptions and scores.
+		existing.AvailableClasses = user.AvailableClasses
+		user = existing
 	}
 
 	err = s.users.Set(ctx, userID, user)
 	if err != nil {
 		return errors.Wrap(err, "couldn't save user")
 	}
+	if authorizedAgain {
+		err = s.users.SetPaused(ctx, userID, false)
+		if err != nil {
+			return errors.Wrap(err, "couldn't resume checking user")
+		}
+	}
 
 	lines := make([]string, len(user.AvailableClasses)+1)
 	lines[0] = "These are the classes you can subscribe to:"
@@ -96,11 +177,31 @@ func (s *Service) HandleCredentialsProvidedEvent(ctx context.Context, message *s
 	return nil
 }
 
-func initializeUser(ctx context.Context, session string) (*marks.User, error) {
-	cli := &http.Client{}
+// HandleCredentialsInvalidatedEvent pauses checking the user's scores until they provide new credentials.
+func (s *Service) HandleCredentialsInvalidatedEvent(ctx context.Context, message *subscriber.Message, e interface{}) error {
+	event, ok := e.(*credentials.CredentialsInvalidatedEvent)
+	if !ok {
+		return subscriber.NewNonRetryableError(errors.Errorf("unexpected event type %T", e))
+	}
+	userID := event.UserID
+	s.accessTokens.Invalidate(userID)
+
+	err := s.users.SetPaused(ctx, userID, true)
+	if err != nil {
+		if errors.Cause(err) == marks.ErrUserNotFound {
+			// The user hasn't been initialized yet, there's nothing to pause.
+			return nil
+		}
+		return errors.Wrap(err, "couldn't pause user")
+	}
+
+	return nil
+}
+
+func initializeUser(ctx context.Context, u usos) (*marks.User, error) {
 	out := &marks.User{}
 
-	classes, err := getClasses(ctx, cli, session)
+	classes, err := u.classes(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't get classes")
 	}
@@ -115,12 +216,18 @@ func initializeUser(ctx context.Context, session string) (*marks.User, error) {
 	return out, nil
 }
 
+// RunScoreChecker checks users' scores until ctx is done.
+// The check in progress is finished before returning.
 func (s *Service) RunScoreChecker(ctx context.Context) {
-	for {
-		err := s.checkSingleUser(ctx)
+	for ctx.Err() == nil {
+		// The check in progress shouldn't be interrupted in the middle.
+		err := s.checkSingleUser(context.Background())
 		if err != nil {
 			if errors.Cause(err) == marks.ErrNoUserToCheck {
-				time.Sleep(time.Minute)
+				select {
+				case <-time.After(time.Minute):
+				case <-ctx.Done():
+				}
 				continue
 			}
 			logger.FromContext(ctx).Println(err)
@@ -134,14 +241,19 @@ func (s *Service) checkSingleUser(ctx context.Context) error {
 	if err != nil {
 		return errors.Wrap(err, "couldn't get next user to check")
 	}
+	ctx = users.WithLogger(ctx, userID)
+	if user.Paused {
+		return nil
+	}
 
-	session, err := s.getSession(ctx, userID)
+	u, err := s.getUSOS(ctx, userID)
 	if err != nil {
-		return errors.Wrap(err, "couldn't get session")
+		return errors.Wrap(err, "couldn't get USOS")
 	}
 
-	updatedUser, err := getUpdatedUser(ctx, session, user)
+	updatedUser, err := getUpdatedUser(ctx, u, user)
 	if err != nil {
+		s.invalidateExpiredSession(ctx, userID, u, err)
 		return errors.Wrap(err, "couldn't get updated scores")
 	}
 
@@ -150,6 +262,7 @@ func (s *Service) checkSingleUser(ctx context.Context) error {
 		return nil
 	}
 
+	results := make([]*publisher.Result, 0, len(changes))
 	for class, scores := range changes {
 		lines := make([]string, len(scores)+1)
 		lines[0] = fmt.Sprintf("New scores have appeared in %s:", class)
@@ -157,7 +270,10 @@ func (s *Service) checkSingleUser(ctx context.Context) error {
 			lines[i+1] = fmt.Sprintf("%s: %v/%v", score.Name, score.Actual, score.Max)
 		}
 
-		err = s.sender.SendNotification(ctx, userID, strings.Join(lines, "\n"))
+		results = append(results, s.sender.SendNotificationAsync(ctx, userID, strings.Join(lines, "\n")))
+	}
+	for _, res := range results {
+		err = res.Get(ctx)
 		if err != nil {
 			return errors.Wrap(err, "couldn't send notification")
 		}
@@ -171,18 +287,17 @@ func (s *Service) checkSingleUser(ctx context.Context) error {
 	return nil
 }
 
-func getUpdatedUser(ctx context.Context, session string, user *marks.User) (*marks.User, error) {
-	cli := &http.Client{}
-
+func getUpdatedUser(ctx context.Context, u usos, user *marks.User) (*marks.User, error) {
 	out := &marks.User{
 		AvailableClasses: user.AvailableClasses,
 		ObservedClasses:  user.ObservedClasses,
 		Classes:          make([]marks.Class, len(user.ObservedClasses)),
 		NextCheck:        user.NextCheck,
+		Paused:           user.Paused,
 	}
 
 	for _, class := range out.ObservedClasses {
-		scores, err := getScoresForClass(ctx, cli, session, class.ID)
+		scores, err := u.scoresForClass(ctx, class.ID)
 		if err != nil {
 			return nil, errors.Wrapf(err, "couldn't get scores for class %v", class.ID)
 		}
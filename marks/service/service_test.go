@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cube2222/usos-notifier/marks"
+	"github.com/cube2222/usos-notifier/marks/parser"
+)
+
+type fakeUSOS struct {
+	scores map[string]map[string]*parser.Score
+}
+
+func (u *fakeUSOS) classes(ctx context.Context) (map[string]*parser.Class, error) {
+	return nil, nil
+}
+
+func (u *fakeUSOS) scoresForClass(ctx context.Context, classID string) (map[string]*parser.Score, error) {
+	return u.scores[classID], nil
+}
+
+func TestGetUpdatedUser(t *testing.T) {
+	user := &marks.User{
+		ObservedClasses: []marks.ClassHeader{{ID: "1", Name: "Calculus"}},
+		Paused:          true,
+	}
+	u := &fakeUSOS{scores: map[string]map[string]*parser.Score{
+		"1": {"Exam": {Actual: 40, Max: 50}},
+	}}
+
+	updated, err := getUpdatedUser(context.Background(), u, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated.Paused {
+		t.Error("expected the user to stay paused")
+	}
+	if changes := getChangedScores(user, updated); len(changes["Calculus"]) != 1 {
+		t.Errorf("expected the new score to be reported, got %v", changes)
+	}
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/common/usosapi"
+	"github.com/cube2222/usos-notifier/credentials"
+	"github.com/cube2222/usos-notifier/marks/parser"
+	"github.com/pkg/errors"
+)
+
+// usos gets the classes and scores of a user, either by scraping USOSweb or through the USOS API.
+type usos interface {
+	classes(ctx context.Context) (map[string]*parser.Class, error)
+	scoresForClass(ctx context.Context, classID string) (map[string]*parser.Score, error)
+}
+
+type usoswebScraper struct {
+	httpCli *http.Client
+	session *usosSession
+}
+
+func (u *usoswebScraper) classes(ctx context.Context) (map[string]*parser.Class, error) {
+	return getClasses(ctx, u.httpCli, u.session)
+}
+
+func (u *usoswebScraper) scoresForClass(ctx context.Context, classID string) (map[string]*parser.Score, error) {
+	return getScoresForClass(ctx, u.httpCli, u.session, classID)
+}
+
+func (s *Service) getAccessToken(ctx context.Context, userID users.UserID) (*credentials.GetAccessTokenResponse, error) {
+	return s.credentials.GetAccessToken(ctx, &credentials.GetAccessTokenRequest{
+		Userid: userID.String(),
+	})
+}
+
+// getUSOS uses the USOS API for users who authorized through it, and scrapes USOSweb for the others.
+func (s *Service) getUSOS(ctx context.Context, userID users.UserID) (usos, error) {
+	res, err := s.accessTokens.Get(ctx, userID)
+	if err == nil {
+		consumer, ok := s.usosAPIConsumers[res.University]
+		if !ok {
+			return nil, errors.Errorf("no USOS API consumer for university %v", res.University)
+		}
+		return &usosAPI{
+			cli: usosapi.NewClient(&http.Client{}, res.UsosapiUrl, consumer),
+			token: &usosapi.Token{
+				Token:  res.Token,
+				Secret: res.TokenSecret,
+			},
+		}, nil
+	}
+	if err != errNoAccessToken {
+		// A rejected access token is reported as an invalid password, so it isn't retried.
+		return nil, errors.Wrap(credentials.LoginErrorFromStatus(err), "couldn't get access token from credentials service")
+	}
+
+	session, err := s.getSession(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get session")
+	}
+
+	return &usoswebScraper{
+		httpCli: &http.Client{},
+		session: session,
+	}, nil
+}
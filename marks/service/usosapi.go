@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/tracing"
+	"github.com/cube2222/usos-notifier/common/usosapi"
+	"github.com/cube2222/usos-notifier/credentials"
+	"github.com/cube2222/usos-notifier/marks/parser"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// usosAPI gets the classes and scores through the USOS API, the class IDs are the course test IDs, same as on USOSweb.
+type usosAPI struct {
+	cli   *usosapi.Client
+	token *usosapi.Token
+}
+
+func (u *usosAPI) call(ctx context.Context, method string, params url.Values, out interface{}) (err error) {
+	defer func(start time.Time) {
+		observeUSOSAPICall(method, start, err)
+	}(time.Now())
+	ctx, span := tracing.StartSpan(ctx, "usos.api",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("usos.method", method)),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	err = u.cli.Call(ctx, method, params, u.token, out)
+	if errors.Cause(err) == usosapi.ErrUnauthorized {
+		// The user revoked the access token, just like changing the password it requires authorizing again.
+		return errors.Wrap(credentials.ErrInvalidPassword, "access token rejected by the USOS API")
+	}
+	return err
+}
+
+// langDict is a text in multiple languages.
+type langDict map[string]string
+
+func (d langDict) String() string {
+	if d["pl"] != "" {
+		return d["pl"]
+	}
+	return d["en"]
+}
+
+type participantTests struct {
+	// Tests are the course tests by term ID and then by node ID.
+	Tests map[string]map[string]struct {
+		Name langDict `json:"name"`
+	} `json:"tests"`
+}
+
+func (u *usosAPI) classes(ctx context.Context) (map[string]*parser.Class, error) {
+	var res participantTests
+	err := u.call(ctx, "services/crstests/participant", nil, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get course tests")
+	}
+
+	classes := map[string]*parser.Class{}
+	for _, tests := range res.Tests {
+		for id, test := range tests {
+			classes[id] = &parser.Class{
+				Name: test.Name.String(),
+			}
+		}
+	}
+
+	return classes, nil
+}
+
+// testNode is a node of the course test tree, a folder or a task with points.
+type testNode struct {
+	ID        json.Number `json:"node_id"`
+	Name      langDict    `json:"name"`
+	Type      string      `json:"type"`
+	PointsMax json.Number `json:"points_max"`
+	Subnodes  []*testNode `json:"subnodes"`
+}
+
+// taskNodeType is the type of nodes students get points for.
+const taskNodeType = "pkt"
+
+type userPoints struct {
+	NodeID json.Number `json:"node_id"`
+	Points json.Number `json:"points"`
+}
+
+func (u *usosAPI) scoresForClass(ctx context.Context, classID string) (map[string]*parser.Score, error) {
+	var root testNode
+	err := u.call(ctx, "services/crstests/node", url.Values{
+		"node_id":   {classID},
+		"recursive": {"true"},
+		"fields":    {"node_id|name|type|points_max|subnodes"},
+	}, &root)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get course test")
+	}
+
+	tasks := map[string]*testNode{}
+	getTasks(tasks, "", root.Subnodes)
+	if len(tasks) == 0 {
+		return map[string]*parser.Score{}, nil
+	}
+
+	nodeIDs := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		nodeIDs = append(nodeIDs, task.ID.String())
+	}
+	var points []*userPoints
+	err = u.call(ctx, "services/crstests/user_points", url.Values{
+		"node_ids": {strings.Join(nodeIDs, "|")},
+	}, &points)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get points")
+	}
+
+	return makeScores(tasks, points)
+}
+
+// getTasks collects the tasks under the nodes, by their path of names, the same as on USOSweb.
+func getTasks(tasks map[string]*testNode, prefix string, nodes []*testNode) {
+	for _, node := range nodes {
+		name := prefix + node.Name.String()
+		if node.Type == taskNodeType {
+			tasks[name] = node
+			continue
+		}
+		getTasks(tasks, name+"/", node.Subnodes)
+	}
+}
+
+// makeScores matches the points to the tasks, tasks without points are unknown.
+func makeScores(tasks map[string]*testNode, points []*userPoints) (map[string]*parser.Score, error) {
+	pointsByNode := make(map[string]string, len(points))
+	for _, p := range points {
+		pointsByNode[p.NodeID.String()] = p.Points.String()
+	}
+
+	scores := make(map[string]*parser.Score, len(tasks))
+	for name, task := range tasks {
+		score := &parser.Score{}
+		if task.PointsMax != "" {
+			max, err := strconv.ParseFloat(task.PointsMax.String(), 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid max points of %v", name)
+			}
+			score.Max = max
+		}
+
+		actual, ok := pointsByNode[task.ID.String()]
+		if !ok || actual == "" {
+			score.Unknown = true
+		} else {
+			value, err := strconv.ParseFloat(actual, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid points of %v", name)
+			}
+			score.Actual = value
+		}
+
+		scores[name] = score
+	}
+
+	return scores, nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/cube2222/usos-notifier/marks/parser"
+)
+
+func TestMakeScores(t *testing.T) {
+	var root testNode
+	err := json.Unmarshal([]byte(`{
+		"node_id": 1, "name": {"pl": "Analiza", "en": "Calculus"}, "type": "root", "points_max": null,
+		"subnodes": [
+			{"node_id": 2, "name": {"pl": "Kolokwium"}, "type": "fld", "points_max": null, "subnodes": [
+				{"node_id": 3, "name": {"pl": "Zadanie 1"}, "type": "pkt", "points_max": 10, "subnodes": []},
+				{"node_id": 4, "name": {"pl": "Zadanie 2"}, "type": "pkt", "points_max": "12.5", "subnodes": []}
+			]},
+			{"node_id": 5, "name": {"en": "Exam"}, "type": "pkt", "points_max": 50, "subnodes": []},
+			{"node_id": 6, "name": {"pl": "Ocena"}, "type": "oc", "subnodes": []}
+		]
+	}`), &root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks := map[string]*testNode{}
+	getTasks(tasks, "", root.Subnodes)
+
+	var points []*userPoints
+	err = json.Unmarshal([]byte(`[{"node_id": 3, "points": 7.5}, {"node_id": "5", "points": "40"}]`), &points)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scores, err := makeScores(tasks, points)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]*parser.Score{
+		"Kolokwium/Zadanie 1": {Actual: 7.5, Max: 10},
+		"Kolokwium/Zadanie 2": {Unknown: true, Max: 12.5},
+		"Exam":                {Actual: 40, Max: 50},
+	}
+	if !reflect.DeepEqual(scores, expected) {
+		t.Errorf("expected %+v, got %+v", expected, scores)
+	}
+}
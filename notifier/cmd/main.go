@@ -15,8 +15,16 @@ import (
 	"github.com/cube2222/grpc-utils/logger"
 	"github.com/cube2222/grpc-utils/requestid"
 
+	"github.com/cube2222/usos-notifier/common/events/outbox"
+	outboxdatastore "github.com/cube2222/usos-notifier/common/events/outbox/datastore"
 	"github.com/cube2222/usos-notifier/common/events/publisher"
+	"github.com/cube2222/usos-notifier/common/events/recording"
 	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	subscriberdatastore "github.com/cube2222/usos-notifier/common/events/subscriber/datastore"
+	"github.com/cube2222/usos-notifier/common/events/transport/cloudpubsub"
+	"github.com/cube2222/usos-notifier/common/lifecycle"
+	"github.com/cube2222/usos-notifier/common/metrics"
+	"github.com/cube2222/usos-notifier/common/tracing"
 	"github.com/cube2222/usos-notifier/notifier"
 	"github.com/cube2222/usos-notifier/notifier/service"
 	"github.com/cube2222/usos-notifier/notifier/service/datastore"
@@ -34,12 +42,60 @@ func main() {
 	if err != nil {
 		log.Fatal("Couldn't create pubsub client: ", err)
 	}
+	pubsubTransport := cloudpubsub.
+		NewTransport(pubsubCli).
+		WithBatching(cloudpubsub.BatchSettings{
+			CountThreshold: config.PublishBatchCount,
+			ByteThreshold:  config.PublishBatchBytes,
+			DelayThreshold: config.PublishBatchDelay,
+		})
+	err = pubsubTransport.Declare(context.Background(), config.CommandsTopic, config.UserCreatedTopic, config.DeadLetterTopic)
+	if err != nil {
+		log.Fatal("Couldn't declare pubsub topics: ", err)
+	}
+
+	lc := lifecycle.New(config.ShutdownTimeout)
+	shutdownTracing, err := tracing.Init("notifier", config.TracingExporter, config.TracingFile)
+	if err != nil {
+		log.Fatal("Couldn't set up tracing: ", err)
+	}
+	lc.OnShutdown("tracing", shutdownTracing)
+	lc.OnShutdown("pubsub", func(ctx context.Context) error {
+		pubsubTransport.Stop()
+		return pubsubCli.Close()
+	})
+
+	recorder, err := recording.NewFileRecorder(config.RecordingFile, config.RecordingMaxSize, config.RecordingMaxFiles)
+	if err != nil {
+		log.Fatal("Couldn't create event recorder: ", err)
+	}
+	lc.OnShutdown("recorder", func(ctx context.Context) error {
+		return recorder.Close()
+	})
+	chainDeps := subscriber.ChainDeps{
+		Logger:          logger.NewStdLogger(),
+		Recorder:        recorder,
+		SeenStore:       subscriberdatastore.NewSeenStore(ds, config.DeduplicationRetention),
+		DeadLetter:      pubsubTransport,
+		DeadLetterTopic: config.DeadLetterTopic,
+		Retry: subscriber.RetryConfig{
+			MaxAttempts:    config.MaxDeliveryAttempts,
+			InitialBackoff: config.RetryInitialBackoff,
+			MaxBackoff:     config.RetryMaxBackoff,
+		},
+	}
+
+	pub := publisher.
+		NewPublisher(pubsubTransport).
+		WithContentEncoding(config.PublishContentEncoding).
+		Use(publisher.WithRequestID).
+		Use(publisher.WithTracing).
+		Use(publisher.WithMetrics)
+	lc.OnShutdown("publisher", pub.Stop)
 
 	s, err := service.NewService(
 		datastore.NewUserMapping(ds),
-		publisher.
-			NewPublisher(pubsubCli).
-			Use(publisher.WithRequestID),
+		pub,
 		service.NewMessengerRateLimiter(config.UserPerHourRateLimit, config.GeneralPerHourRateLimit),
 		config,
 	)
@@ -47,28 +103,39 @@ func main() {
 		log.Fatal("Couldn't create service: ", err)
 	}
 
-	go func() {
-		log.Fatal(
-			subscriber.
-				NewSubscriptionClient(pubsubCli).
-				Subscribe(
-					context.Background(),
-					config.NotificationsSubscription,
-					subscriber.Chain(
-						s.HandleMessageSendEvent,
-						subscriber.WithLogger(logger.NewStdLogger()),
-						subscriber.WithRequestID,
-						subscriber.WithLogging(requestid.Key),
-					),
-				),
-		)
-	}()
+	// Set up publishing of the events saved in the outbox
+	relay := outbox.NewRelay(outboxdatastore.NewStore(ds), pub, config.OutboxRelayInterval, config.OutboxRelayTimeout, config.OutboxBatchSize, config.OutboxMaxAttempts)
+	lc.Go("outbox relay", relay.Run)
+
+	lc.Go("notifications subscription", func(ctx context.Context) error {
+		return subscriber.
+			NewSubscriptionClient(pubsubTransport).
+			WithReceiveSettings(config.NotificationsFlowControl.ReceiveSettings()).
+			SubscribeTyped(
+				ctx,
+				config.NotificationsSubscription,
+				notifier.SendNotificationEventName,
+				s.HandleMessageSendEvent,
+				subscriber.DefaultChain("notifier.HandleMessageSendEvent", chainDeps, config.NotificationsFlowControl.MaxConcurrentHandlers)...,
+			)
+	})
 
 	m := chi.NewMux()
 	m.Use(requestid.HTTPInterceptor)
+	m.Use(tracing.HTTPInterceptor)
+	m.Use(metrics.HTTPInterceptor)
 	m.Use(logger.HTTPInjector(logger.NewStdLogger(), requestid.Key))
 	m.Use(logger.HTTPLogger())
 	m.HandleFunc("/notifier/webhook", s.HandleMessageReceivedWebhookHTTP)
+	lc.ServeHTTP("http server", &http.Server{
+		Addr:    fmt.Sprintf(":%v", config.ListenPortHttp),
+		Handler: m,
+	})
+	lc.ServeHTTP("metrics server", metrics.NewServer(config.ListenPortMetrics))
 	log.Println("Serving...")
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", config.ListenPortHttp), m))
+
+	err = lc.Wait()
+	if err != nil {
+		log.Fatal(err)
+	}
 }
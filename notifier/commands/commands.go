@@ -15,7 +15,7 @@ import (
 
 type CommandsHandler interface {
 	Handle(matcher Matcher, handler func(ctx context.Context, userID users.UserID, params map[string]string) (string, error))
-	HandleMessage(context.Context, *subscriber.Message) error
+	HandleMessage(ctx context.Context, msg *subscriber.Message, event interface{}) error
 }
 
 type HandleFunc func(ctx context.Context, userID users.UserID, params map[string]string) (string, error)
@@ -60,16 +60,16 @@ func (ch *commandsHandler) Handle(matcher Matcher, handler func(ctx context.Cont
 	ch.router.addRoute(matcher, handler)
 }
 
-func (ch *commandsHandler) HandleMessage(ctx context.Context, msg *subscriber.Message) error {
+func (ch *commandsHandler) HandleMessage(ctx context.Context, msg *subscriber.Message, e interface{}) error {
 	log := logger.FromContext(ctx)
-	userID := users.NewUserID(msg.Attributes["user_id"])
 
-	data, err := subscriber.DecodeTextMessage(msg)
-	if err != nil {
-		return subscriber.NewNonRetryableError(errors.Wrap(err, "couldn't decode text message"))
+	event, ok := e.(*notifier.UserCommandEvent)
+	if !ok {
+		return subscriber.NewNonRetryableError(errors.Errorf("unexpected event type %T", e))
 	}
+	userID := event.UserID
 
-	handler, params, err := ch.router.getHandler(string(data))
+	handler, params, err := ch.router.getHandler(event.Text)
 	if err != nil {
 		log.Println("Omitting message. No match.")
 		return nil
@@ -1,8 +1,15 @@
 package notifier
 
+import (
+	"time"
+
+	"github.com/cube2222/usos-notifier/common/events/subscriber"
+)
+
 type Config struct {
 	DevelopmentMode         bool `default:"false" split_words:"true"`
 	ListenPortHttp          int  `default:"8080" split_words:"true"`
+	ListenPortMetrics       int  `default:"9090" split_words:"true"`
 	GeneralPerHourRateLimit int  `default:"1000" split_words:"true"`
 	UserPerHourRateLimit    int  `default:"100" split_words:"true"`
 
@@ -10,9 +17,39 @@ type Config struct {
 	CommandsTopic                string `default:"notifier-commands" split_words:"true"`
 	NotificationsSubscription    string `default:"notifier-notifications" split_words:"true"`
 	UserCreatedTopic             string `default:"notifier-user_created" split_words:"true"`
+	DeadLetterTopic              string `default:"dead_letter" split_words:"true"`
 	GoogleApplicationCredentials string `default:"/var/secrets/google/serviceaccount.json" split_words:"true"`
 
 	FacebookDomain       string `default:"graph.facebook.com" split_words:"true"`
 	MessengerApiKey      string `required:"true" split_words:"true"`
 	MessengerVerifyToken string `required:"true" split_words:"true"`
+
+	MaxDeliveryAttempts    int           `default:"5" split_words:"true"`
+	RetryInitialBackoff    time.Duration `default:"1s" split_words:"true"`
+	RetryMaxBackoff        time.Duration `default:"1m" split_words:"true"`
+	DeduplicationRetention time.Duration `default:"168h" split_words:"true"`
+	ShutdownTimeout        time.Duration `default:"25s" split_words:"true"`
+	OutboxRelayInterval    time.Duration `default:"1s" split_words:"true"`
+	OutboxRelayTimeout     time.Duration `default:"20s" split_words:"true"`
+	OutboxBatchSize        int           `default:"100" split_words:"true"`
+
+	// Outbox events failing to publish OutboxMaxAttempts times are moved aside, so they don't hold up the later ones.
+	OutboxMaxAttempts int `default:"10" split_words:"true"`
+
+	PublishBatchCount int           `default:"100" split_words:"true"`
+	PublishBatchBytes int           `default:"1000000" split_words:"true"`
+	PublishBatchDelay time.Duration `default:"10ms" split_words:"true"`
+
+	// PublishContentEncoding is base64 or raw, switch to raw only once all subscribers of the topics are upgraded.
+	PublishContentEncoding string `default:"base64" split_words:"true"`
+
+	NotificationsFlowControl subscriber.FlowControlConfig `split_words:"true"`
+
+	TracingExporter string `default:"none" split_words:"true"`
+	TracingFile     string `default:"traces.json" split_words:"true"`
+
+	// Handled events are recorded to RecordingFile if it's set, for debugging with the replay tool.
+	RecordingFile     string `split_words:"true"`
+	RecordingMaxSize  int64  `default:"104857600" split_words:"true"`
+	RecordingMaxFiles int    `default:"5" split_words:"true"`
 }
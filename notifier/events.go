@@ -0,0 +1,70 @@
+package notifier
+
+import (
+	"github.com/cube2222/usos-notifier/common/events"
+	"github.com/cube2222/usos-notifier/common/users"
+)
+
+const (
+	UserCreatedEventName      = "user_created"
+	UserCommandEventName      = "user_command"
+	SendNotificationEventName = "send_notification"
+)
+
+type UserCreatedEvent struct {
+	UserID users.UserID `json:"user_id"`
+}
+
+// UserCommandEvent is a message the user sent us.
+type UserCommandEvent struct {
+	UserID users.UserID `json:"user_id"`
+	Text   string       `json:"text"`
+}
+
+func init() {
+	events.Register(&events.Schema{
+		Name:    UserCreatedEventName,
+		Version: 1,
+		Codec:   events.JSON,
+		New: func() interface{} {
+			return &UserCreatedEvent{}
+		},
+		DecodeLegacy: func(data []byte, attributes map[string]string) (interface{}, error) {
+			// This used to be the bare user ID.
+			return &UserCreatedEvent{
+				UserID: users.NewUserID(string(data)),
+			}, nil
+		},
+	})
+
+	events.Register(&events.Schema{
+		Name:    UserCommandEventName,
+		Version: 1,
+		Codec:   events.JSON,
+		New: func() interface{} {
+			return &UserCommandEvent{}
+		},
+		DecodeLegacy: func(data []byte, attributes map[string]string) (interface{}, error) {
+			// This used to be the bare message text, with the user ID in the attributes.
+			return &UserCommandEvent{
+				UserID: users.NewUserID(attributes["user_id"]),
+				Text:   string(data),
+			}, nil
+		},
+	})
+
+	events.Register(&events.Schema{
+		Name:    SendNotificationEventName,
+		Version: 1,
+		Codec:   events.JSON,
+		New: func() interface{} {
+			return &SendNotificationEvent{}
+		},
+		DecodeLegacy: func(data []byte, attributes map[string]string) (interface{}, error) {
+			// This has always been json, just without the schema attributes.
+			event := &SendNotificationEvent{}
+			err := events.JSON.Unmarshal(data, event)
+			return event, err
+		},
+	})
+}
@@ -3,6 +3,7 @@ package notifier
 import (
 	"context"
 
+	"github.com/cube2222/usos-notifier/common/events/outbox"
 	"github.com/cube2222/usos-notifier/common/users"
 	"github.com/pkg/errors"
 )
@@ -18,7 +19,8 @@ func (id MessengerID) String() string {
 }
 
 type UserMapping interface {
-	CreateUser(ctx context.Context, messengerID MessengerID) (users.UserID, error)
+	// CreateUser saves the user together with the outbox events, in a single transaction.
+	CreateUser(ctx context.Context, userID users.UserID, messengerID MessengerID, events ...*outbox.Event) error
 	GetMessengerID(ctx context.Context, userID users.UserID) (MessengerID, error)
 	GetUserID(ctx context.Context, messengerID MessengerID) (users.UserID, error)
 }
@@ -2,7 +2,6 @@ package notifier
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/cube2222/usos-notifier/common/events/publisher"
 	"github.com/cube2222/usos-notifier/common/users"
@@ -17,6 +16,8 @@ type SendNotificationEvent struct {
 
 type NotificationSender interface {
 	SendNotification(ctx context.Context, userID users.UserID, message string) error
+	// SendNotificationAsync sends the notification in the background, see publisher.PublishEventAsync.
+	SendNotificationAsync(ctx context.Context, userID users.UserID, message string) *publisher.Result
 }
 
 type notificationSender struct {
@@ -32,18 +33,24 @@ func NewNotificationSender(publisher *publisher.Publisher, notificationsTopic st
 }
 
 func (ns *notificationSender) SendNotification(ctx context.Context, userID users.UserID, message string) error {
-	data, err := json.Marshal(SendNotificationEvent{
+	err := ns.publisher.PublishTyped(ctx, ns.notificationsTopic, map[string]string{
+		publisher.UserIDKey: userID.String(),
+	}, &SendNotificationEvent{
 		UserID:  userID,
 		Message: message,
 	})
-	if err != nil {
-		return errors.Wrap(err, "couldn't marshal send notification event")
-	}
-
-	err = ns.publisher.PublishEvent(ctx, "notifications", nil, string(data))
 	if err != nil {
 		return errors.Wrap(err, "couldn't publish event")
 	}
 
 	return nil
 }
+
+func (ns *notificationSender) SendNotificationAsync(ctx context.Context, userID users.UserID, message string) *publisher.Result {
+	return ns.publisher.PublishTypedAsync(ctx, ns.notificationsTopic, map[string]string{
+		publisher.UserIDKey: userID.String(),
+	}, &SendNotificationEvent{
+		UserID:  userID,
+		Message: message,
+	})
+}
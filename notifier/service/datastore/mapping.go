@@ -3,12 +3,13 @@ package datastore
 import (
 	"context"
 
+	"github.com/cube2222/usos-notifier/common/events/outbox"
+	outboxdatastore "github.com/cube2222/usos-notifier/common/events/outbox/datastore"
 	"github.com/cube2222/usos-notifier/common/users"
 	"github.com/cube2222/usos-notifier/notifier"
 
 	"cloud.google.com/go/datastore"
 	"github.com/pkg/errors"
-	"github.com/satori/go.uuid"
 )
 
 const mappingUserIDToMessengerIDTable = "mapping_userid_to_messenger"
@@ -32,15 +33,10 @@ type datastoreMessengerID struct {
 	MessengerID string `json:"messenger_id"`
 }
 
-func (s *userMapping) CreateUser(ctx context.Context, messengerID notifier.MessengerID) (users.UserID, error) {
-	userID, err := uuid.NewV4()
-	if err != nil {
-		return "", errors.Wrap(err, "couldn't generate uuid")
-	}
-
+func (s *userMapping) CreateUser(ctx context.Context, userID users.UserID, messengerID notifier.MessengerID, events ...*outbox.Event) error {
 	tx, err := s.ds.NewTransaction(ctx)
 	if err != nil {
-		return "", errors.Wrap(err, "couldn't begin transaction")
+		return errors.Wrap(err, "couldn't begin transaction")
 	}
 	defer tx.Rollback()
 
@@ -49,19 +45,23 @@ func (s *userMapping) CreateUser(ctx context.Context, messengerID notifier.Messe
 
 	_, err = tx.Put(key1, &datastoreMessengerID{string(messengerID)})
 	if err != nil {
-		return "", errors.Wrap(err, "couldn't create userID to messenger mapping")
+		return errors.Wrap(err, "couldn't create userID to messenger mapping")
 	}
 	_, err = tx.Put(key2, &datastoreUserID{userID.String()})
 	if err != nil {
-		return "", errors.Wrap(err, "couldn't create messenger to userID mapping")
+		return errors.Wrap(err, "couldn't create messenger to userID mapping")
+	}
+	err = outboxdatastore.Add(tx, events...)
+	if err != nil {
+		return errors.Wrap(err, "couldn't add events to outbox")
 	}
 
 	_, err = tx.Commit()
 	if err != nil {
-		return "", errors.Wrap(err, "couldn't commit transaction")
+		return errors.Wrap(err, "couldn't commit transaction")
 	}
 
-	return users.NewUserID(userID.String()), nil
+	return nil
 }
 
 func (s *userMapping) GetMessengerID(ctx context.Context, userID users.UserID) (notifier.MessengerID, error) {
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/cube2222/usos-notifier/common/metrics"
+)
+
+var (
+	messengerSends = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "messenger_sends_total",
+			Help: "Number of messages sent through the Messenger API, by outcome.",
+		},
+		[]string{"outcome"},
+	)
+	messengerSendDuration = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "messenger_send_duration_seconds",
+			Help:    "Time it took to send messages through the Messenger API.",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+)
+
+func observeMessengerSend(start time.Time, err error) {
+	messengerSendDuration.Observe(time.Since(start).Seconds())
+	messengerSends.WithLabelValues(metrics.Outcome(err)).Inc()
+}
@@ -14,11 +14,15 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/cube2222/grpc-utils/logger"
 
+	"github.com/cube2222/usos-notifier/common/events/outbox"
 	"github.com/cube2222/usos-notifier/common/events/publisher"
 	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	"github.com/cube2222/usos-notifier/common/tracing"
+	"github.com/cube2222/usos-notifier/common/users"
 	"github.com/cube2222/usos-notifier/notifier"
 )
 
@@ -118,6 +122,7 @@ func (s *Service) HandleMessageReceivedWebhookHTTP(w http.ResponseWriter, r *htt
 }
 
 func (s *Service) handleMessageReceived(ctx context.Context, webhook MessageEvent) error {
+	ctx = logger.Inject(ctx, logger.FromContext(ctx).With(logger.NewField("messenger_id", webhook.Sender.ID.String())))
 	log := logger.FromContext(ctx)
 
 	rateLimit, limited := s.messengerRateLimiter.LimitMessengerUser(webhook.Sender.ID)
@@ -155,29 +160,40 @@ func (s *Service) handleMessageReceived(ctx context.Context, webhook MessageEven
 	}
 
 	if !userExists {
-		userID, err = s.userMapping.CreateUser(ctx, webhook.Sender.ID)
+		userID, err = users.GenerateUserID()
 		if err != nil {
-			return errors.Wrap(err, "couldn't create user")
+			return errors.Wrap(err, "couldn't generate userID")
 		}
 
-		err = s.publisher.PublishEvent(ctx, s.userCreatedTopic,
+		userCreated, err := outbox.NewEvent(ctx, s.userCreatedTopic,
 			map[string]string{
-				"origin": "fb_messenger",
+				publisher.UserIDKey: userID.String(),
+				publisher.OriginKey: "fb_messenger",
+			},
+			&notifier.UserCreatedEvent{
+				UserID: userID,
 			},
-			userID.String(),
 		)
 		if err != nil {
-			return errors.Wrap(err, "couldn't publish user created event")
+			return errors.Wrap(err, "couldn't create user created event")
 		}
 
+		err = s.userMapping.CreateUser(ctx, userID, webhook.Sender.ID, userCreated)
+		if err != nil {
+			return errors.Wrap(err, "couldn't create user")
+		}
 	}
+	ctx = users.WithLogger(ctx, userID)
 
-	err = s.publisher.PublishEvent(ctx, s.commandsTopic,
+	err = s.publisher.PublishTyped(ctx, s.commandsTopic,
 		map[string]string{
-			"user_id": userID.String(),
-			"origin":  "fb_messenger",
+			publisher.UserIDKey: userID.String(),
+			publisher.OriginKey: "fb_messenger",
+		},
+		&notifier.UserCommandEvent{
+			UserID: userID,
+			Text:   webhook.Message.Text,
 		},
-		webhook.Message.Text,
 	)
 	if err != nil {
 		return errors.Wrap(err, "couldn't publish event")
@@ -186,12 +202,10 @@ func (s *Service) handleMessageReceived(ctx context.Context, webhook MessageEven
 	return nil
 }
 
-func (s *Service) HandleMessageSendEvent(ctx context.Context, message *subscriber.Message) error {
-	event := notifier.SendNotificationEvent{}
-
-	err := subscriber.DecodeJSONMessage(message, &event)
-	if err != nil {
-		return subscriber.NewNonRetryableError(errors.Wrap(err, "couldn't decode json message"))
+func (s *Service) HandleMessageSendEvent(ctx context.Context, message *subscriber.Message, e interface{}) error {
+	event, ok := e.(*notifier.SendNotificationEvent)
+	if !ok {
+		return subscriber.NewNonRetryableError(errors.Errorf("unexpected event type %T", e))
 	}
 
 	messengerID, err := s.userMapping.GetMessengerID(ctx, event.UserID)
@@ -211,7 +225,15 @@ func (s *Service) HandleMessageSendEvent(ctx context.Context, message *subscribe
 	return nil
 }
 
-func (s *Service) sendMessage(ctx context.Context, messengerID notifier.MessengerID, body string) error {
+func (s *Service) sendMessage(ctx context.Context, messengerID notifier.MessengerID, body string) (err error) {
+	defer func(start time.Time) {
+		observeMessengerSend(start, err)
+	}(time.Now())
+	ctx, span := tracing.StartSpan(ctx, "messenger.send", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	message := struct {
 		MessagingType string `json:"messaging_type"`
 		Recipient     struct {
@@ -245,6 +267,7 @@ func (s *Service) sendMessage(ctx context.Context, messengerID notifier.Messenge
 	}
 
 	req.Header.Add("content-type", "application/json")
+	req = req.WithContext(ctx)
 
 	res, err := s.cli.Do(req)
 	if err != nil {
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	gdatastore "cloud.google.com/go/datastore"
+	"github.com/kelseyhightower/envconfig"
+	"google.golang.org/api/option"
+
+	"github.com/cube2222/usos-notifier/common/users"
+	"github.com/cube2222/usos-notifier/credentials"
+	"github.com/cube2222/usos-notifier/credentials/encryption"
+	"github.com/cube2222/usos-notifier/credentials/service/datastore"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Re-encrypts all stored credentials with the current key and additional authenticated data.\n")
+	fmt.Fprintf(os.Stderr, "It's configured with the same environment variables as the credentials service.\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	config := &credentials.Config{}
+	envconfig.MustProcess("credentials", config)
+
+	stateFile := flag.String("state", "reencrypt.state", "File saving the progress, the job resumes from it when restarted. Empty to disable.")
+	after := flag.String("after", "", "Start after this user ID, overriding the state file.")
+	batchSize := flag.Int("batch-size", 100, "Number of credentials handled per batch.")
+	flag.Usage = usage
+	flag.Parse()
+
+	ctx := context.Background()
+
+	ds, err := gdatastore.NewClient(ctx, config.ProjectName, option.WithCredentialsFile(config.GoogleApplicationCredentials))
+	if err != nil {
+		log.Fatal("Couldn't create datastore client: ", err)
+	}
+	keyring, err := config.Encryption.Keyring(ctx, config.EncryptionKeyID)
+	if err != nil {
+		log.Fatal("Couldn't create encryption keyring: ", err)
+	}
+	additionalData := encryption.NewAdditionalData(
+		config.AdditionalAuthenticatedDataVersion,
+		config.AdditionalAuthenticatedData,
+		config.PreviousAdditionalAuthenticatedData,
+	)
+	reencrypter := datastore.NewReEncrypter(ds, keyring, additionalData)
+
+	last := users.NewUserID(*after)
+	if last == "" && *stateFile != "" {
+		data, err := ioutil.ReadFile(*stateFile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatal("Couldn't read state file: ", err)
+		}
+		last = users.NewUserID(strings.TrimSpace(string(data)))
+	}
+	if last != "" {
+		log.Printf("Resuming after user %v.", last)
+	}
+
+	total, err := reencrypter.Count(ctx)
+	if err != nil {
+		log.Fatal("Couldn't count credentials: ", err)
+	}
+	legacy, err := reencrypter.CountLegacy(ctx)
+	if err != nil {
+		log.Fatal("Couldn't count legacy credentials: ", err)
+	}
+	log.Printf("%d of %d credentials use the legacy record format.", legacy, total)
+
+	checked, reencrypted := 0, 0
+	for {
+		batchLast, n, m, err := reencrypter.ReEncryptBatch(ctx, last, *batchSize)
+		checked += n
+		reencrypted += m
+		if batchLast != "" {
+			last = batchLast
+			saveState(*stateFile, last)
+		}
+		if err != nil {
+			log.Fatalf("Couldn't re-encrypt credentials, rerun to resume after user %v: %v", last, err)
+		}
+		if batchLast == "" {
+			break
+		}
+
+		log.Printf("Checked %d of %d credentials, re-encrypted %d, last user %v.", checked, total, reencrypted, last)
+	}
+
+	log.Printf("Done, re-encrypted %d credentials with key %v.", reencrypted, keyring.PrimaryKeyID())
+	legacy, err = reencrypter.CountLegacy(ctx)
+	if err != nil {
+		log.Fatal("Couldn't count legacy credentials: ", err)
+	}
+	if legacy > 0 {
+		log.Printf("%d credentials still use the legacy record format, rerun the job.", legacy)
+	} else {
+		log.Printf("No legacy credentials left, set CREDENTIALS_REJECT_LEGACY_RECORDS=true.")
+	}
+	if *stateFile != "" {
+		err := os.Remove(*stateFile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Couldn't remove state file: %v", err)
+		}
+	}
+}
+
+func saveState(path string, last users.UserID) {
+	if path == "" {
+		return
+	}
+	err := ioutil.WriteFile(path, []byte(last.String()), 0644)
+	if err != nil {
+		log.Printf("Couldn't save state file: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/kelseyhightower/envconfig"
+	"google.golang.org/api/option"
+
+	"github.com/cube2222/usos-notifier/common/events"
+	"github.com/cube2222/usos-notifier/common/events/recording"
+	"github.com/cube2222/usos-notifier/common/events/subscriber"
+	"github.com/cube2222/usos-notifier/common/events/transport/cloudpubsub"
+	"github.com/cube2222/usos-notifier/replay"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] list|replay\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Set PUBSUB_EMULATOR_HOST to replay messages to a locally running service.\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	config := &replay.Config{}
+	envconfig.MustProcess("replay", config)
+
+	file := flag.String("file", "", "Recording file written by the service.")
+	filter := &recording.Filter{}
+	flag.StringVar(&filter.RequestID, "request-id", "", "Only select messages with this request ID.")
+	flag.StringVar(&filter.UserID, "user-id", "", "Only select messages about this user.")
+	flag.StringVar(&filter.Handler, "handler", "", "Only select messages handled by this handler.")
+	flag.StringVar(&filter.Outcome, "outcome", "", "Only select messages with this outcome: ack, nack or permanent.")
+	topic := flag.String("topic", "", "Topic to replay the messages to. Defaults to the topic they were originally published to.")
+	keepIdempotencyKey := flag.Bool("keep-idempotency-key", false, "Keep the original idempotency keys, so already handled messages get deduplicated.")
+	flag.Usage = usage
+	flag.Parse()
+
+	command := flag.Arg(0)
+	if (command != "list" && command != "replay") || *file == "" {
+		usage()
+		os.Exit(2)
+	}
+
+	msgs, err := recording.ReadFiles(*file, filter)
+	if err != nil {
+		log.Fatal("Couldn't read recorded messages: ", err)
+	}
+
+	if command == "list" {
+		for _, msg := range msgs {
+			printMessage(msg)
+		}
+		return
+	}
+
+	var opts []option.ClientOption
+	if config.GoogleApplicationCredentials != "" {
+		opts = append(opts, option.WithCredentialsFile(config.GoogleApplicationCredentials))
+	}
+	pubsubCli, err := pubsub.NewClient(context.Background(), config.ProjectName, opts...)
+	if err != nil {
+		log.Fatal("Couldn't create pubsub client: ", err)
+	}
+	pubsubTransport := cloudpubsub.NewTransport(pubsubCli)
+	defer pubsubTransport.Stop()
+
+	for _, msg := range msgs {
+		target := msg.Topic
+		if *topic != "" {
+			target = *topic
+		}
+		if target == "" {
+			log.Printf("Not replaying message %v, unknown topic.", msg.MessageID)
+			continue
+		}
+
+		// Only the recorded handler handles the message, the other subscriptions of the topic skip it.
+		attributes, err := subscriber.ReplayAttributes(msg.Attributes, msg.Handler, *keepIdempotencyKey)
+		if err != nil {
+			log.Fatal("Couldn't get replay attributes: ", err)
+		}
+
+		err = pubsubTransport.Declare(context.Background(), target)
+		if err != nil {
+			log.Printf("Couldn't declare topic %v: %v", target, err)
+			continue
+		}
+		id, err := pubsubTransport.Publish(context.Background(), target, msg.Data, attributes)
+		if err != nil {
+			log.Printf("Couldn't replay message %v: %v", msg.MessageID, err)
+			continue
+		}
+		log.Printf("Replayed message %v to %v as %v.", msg.MessageID, target, id)
+	}
+}
+
+func printMessage(msg *subscriber.RecordedMessage) {
+	data, err := events.DecodePayload(msg.Data, msg.Attributes)
+	if err != nil {
+		data = msg.Data
+	}
+
+	fmt.Printf("Message %v\n", msg.MessageID)
+	fmt.Printf("\tTopic: %v\n", msg.Topic)
+	fmt.Printf("\tHandler: %v\n", msg.Handler)
+	fmt.Printf("\tTime: %v\n", msg.Time)
+	fmt.Printf("\tOutcome: %v\n", msg.Outcome)
+	fmt.Printf("\tDuration: %v\n", msg.Duration)
+	if msg.Error != "" {
+		fmt.Printf("\tError: %v\n", msg.Error)
+	}
+	fmt.Printf("\tAttributes: %v\n", msg.Attributes)
+	fmt.Printf("\tData: %s\n", data)
+}
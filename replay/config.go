@@ -0,0 +1,7 @@
+package replay
+
+type Config struct {
+	ProjectName string `default:"usos-notifier" split_words:"true"`
+	// GoogleApplicationCredentials may be empty when replaying to the Pub/Sub emulator.
+	GoogleApplicationCredentials string `split_words:"true"`
+}